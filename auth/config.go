@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"lunchorder/config"
+)
+
+// LoadProviders builds the registry from the configuration. Google is always
+// registered; additional OIDC issuers are registered when their discovery
+// document can be fetched.
+func LoadProviders(ctx context.Context, google config.GoogleConfig, issuers []config.OIDCConfig) *Registry {
+	registry := NewRegistry(NewGoogleProvider(google.ClientID, google.ClientSecret, google.RedirectURL))
+
+	for _, issuer := range issuers {
+		provider, err := NewOIDCProvider(ctx, issuer)
+		if err != nil {
+			slog.WarnContext(ctx, "Skipping OIDC provider", "provider", issuer.Name, "error", err)
+			continue
+		}
+
+		registry.Register(provider)
+	}
+
+	return registry
+}
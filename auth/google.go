@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const googleUserInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
+
+// GoogleProvider signs users in through Google's OAuth2 userinfo endpoint
+type GoogleProvider struct {
+	oauthConf *oauth2.Config
+}
+
+func NewGoogleProvider(clientID string, clientSecret string, redirectURL string) *GoogleProvider {
+	return &GoogleProvider{
+		oauthConf: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes: []string{
+				"https://www.googleapis.com/auth/userinfo.email",
+				"https://www.googleapis.com/auth/userinfo.profile",
+			},
+			Endpoint: google.Endpoint,
+		},
+	}
+}
+
+func (p *GoogleProvider) Name() string {
+	return "google"
+}
+
+func (p *GoogleProvider) Issuer() string {
+	return "https://accounts.google.com"
+}
+
+func (p *GoogleProvider) AuthCodeURL(state string, nonce string, verifier string) string {
+	return p.oauthConf.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+}
+
+func (p *GoogleProvider) Exchange(ctx context.Context, code string, nonce string, verifier string) (*Identity, error) {
+	token, err := p.oauthConf.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+
+	response, err := p.oauthConf.Client(ctx, token).Get(googleUserInfoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting user info: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed getting user info: status %d", response.StatusCode)
+	}
+
+	contents, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading response body: %w", err)
+	}
+
+	var googleUser struct {
+		ID            string `json:"id"`
+		Email         string `json:"email"`
+		VerifiedEmail bool   `json:"verified_email"`
+		Name          string `json:"name"`
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+		Picture       string `json:"picture"`
+	}
+
+	if err := json.Unmarshal(contents, &googleUser); err != nil {
+		return nil, fmt.Errorf("failed unmarshaling json: %w", err)
+	}
+
+	return &Identity{
+		Subject:       googleUser.ID,
+		Email:         googleUser.Email,
+		EmailVerified: googleUser.VerifiedEmail,
+		EmailTrusted:  googleUser.VerifiedEmail,
+		Name:          googleUser.Name,
+		GivenName:     googleUser.GivenName,
+		FamilyName:    googleUser.FamilyName,
+		Picture:       googleUser.Picture,
+	}, nil
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"lunchorder/config"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// legacyKeyID is the kid given to JWT_SECRET, which also verifies tokens issued before kids existed
+const legacyKeyID = "default"
+
+const insecureDefaultSecret = "default_secret_key_change_me"
+
+// minSecretLength is the shortest HS256 secret accepted in release mode
+const minSecretLength = 32
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is one entry of the keyring. Private is nil for verification-only keys.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// Keyring signs tokens with one key and verifies them against any known key,
+// chosen by the token's kid header, so keys can be rotated without logging everyone out
+type Keyring struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+func NewKeyring(signingKeyID string, keys ...*Key) (*Keyring, error) {
+	keyring := &Keyring{keys: map[string]*Key{}}
+	for _, key := range keys {
+		if _, exists := keyring.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate jwt key id %q", key.ID)
+		}
+		keyring.keys[key.ID] = key
+	}
+
+	signing, ok := keyring.keys[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q is not in the keyring", signingKeyID)
+	}
+	if signing.Private == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKeyID)
+	}
+	keyring.signing = signing
+
+	return keyring, nil
+}
+
+// LoadKeyring builds the keyring from the configuration.
+//
+// JWT_KEYS holds comma-separated "kid:alg:value" entries. For HS256 the value is
+// the secret; for EdDSA and RS256 it is the path to a PEM file with either a
+// private key (sign and verify) or a public key (verify only). JWT_SIGNING_KEY_ID
+// picks the signing key and defaults to the first entry. The legacy JWT_SECRET is
+// still accepted as an HS256 key with kid "default".
+//
+// In release mode a missing, default or short secret is a fatal configuration
+// error; otherwise an insecure development key is used with a warning.
+func LoadKeyring(config config.JWTConfig, release bool) (*Keyring, error) {
+	var keys []*Key
+
+	for _, entry := range config.Keys {
+		key, err := parseKeyEntry(entry, release)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if config.Secret != "" {
+		key, err := newHMACKey(legacyKeyID, config.Secret, release)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_SECRET: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		if release {
+			return nil, errors.New("JWT_KEYS or JWT_SECRET must be set in release mode")
+		}
+		slog.Warn("JWT_KEYS and JWT_SECRET are not set, using an insecure development key")
+		keys = append(keys, &Key{
+			ID:      legacyKeyID,
+			Method:  jwt.SigningMethodHS256,
+			Private: []byte(insecureDefaultSecret),
+			Public:  []byte(insecureDefaultSecret),
+		})
+	}
+
+	signingKeyID := config.SigningKeyID
+	if signingKeyID == "" {
+		signingKeyID = keys[0].ID
+	}
+
+	return NewKeyring(signingKeyID, keys...)
+}
+
+func parseKeyEntry(entry string, release bool) (*Key, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("JWT_KEYS entry must look like kid:alg:value")
+	}
+	id, alg, value := parts[0], strings.ToUpper(parts[1]), parts[2]
+
+	switch alg {
+	case "HS256":
+		key, err := newHMACKey(id, value, release)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_KEYS %s: %w", id, err)
+		}
+		return key, nil
+	case "EDDSA", "RS256":
+		pem, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_KEYS %s: %w", id, err)
+		}
+		key, err := parsePEMKey(id, alg, pem)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_KEYS %s: %w", id, err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("JWT_KEYS %s: unsupported algorithm %q, use HS256, EdDSA or RS256", id, parts[1])
+	}
+}
+
+func newHMACKey(id string, secret string, release bool) (*Key, error) {
+	if release && (secret == insecureDefaultSecret || len(secret) < minSecretLength) {
+		return nil, fmt.Errorf("secret must be at least %d characters and not the default in release mode", minSecretLength)
+	}
+	return &Key{
+		ID:      id,
+		Method:  jwt.SigningMethodHS256,
+		Private: []byte(secret),
+		Public:  []byte(secret),
+	}, nil
+}
+
+func parsePEMKey(id string, alg string, pem []byte) (*Key, error) {
+	if alg == "EDDSA" {
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(pem); err == nil {
+			return &Key{ID: id, Method: jwt.SigningMethodEdDSA, Private: private, Public: private.(ed25519.PrivateKey).Public()}, nil
+		}
+		public, err := jwt.ParseEdPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, errors.New("file is not an Ed25519 PEM key")
+		}
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, Public: public}, nil
+	}
+
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(pem); err == nil {
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, Private: private, Public: &private.PublicKey}, nil
+	}
+	public, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+	if err != nil {
+		return nil, errors.New("file is not an RSA PEM key")
+	}
+	return &Key{ID: id, Method: jwt.SigningMethodRS256, Public: public}, nil
+}
+
+// Sign issues a token with the current signing key and its kid header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	token.Header["kid"] = k.signing.ID
+	return token.SignedString(k.signing.Private)
+}
+
+// Parse verifies a token against the key named by its kid header
+func (k *Keyring) Parse(tokenString string, options ...jwt.ParserOption) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, k.keyfunc, options...)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid claims")
+	}
+	return claims, nil
+}
+
+func (k *Keyring) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = legacyKeyID
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	// Never let the token choose the algorithm, e.g. HS256 signed with an RSA public key
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+// JWKS lists the public halves of the asymmetric keys so other services can verify tokens.
+// Symmetric keys are never published.
+func (k *Keyring) JWKS() map[string]interface{} {
+	keys := []map[string]string{}
+
+	for _, key := range k.keys {
+		switch public := key.Public.(type) {
+		case ed25519.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"use": "sig",
+				"alg": "EdDSA",
+				"kid": key.ID,
+				"x":   base64.RawURLEncoding.EncodeToString(public),
+			})
+		case *rsa.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": key.ID,
+				"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		}
+	}
+
+	return map[string]interface{}{"keys": keys}
+}
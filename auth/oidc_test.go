@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"lunchorder/config"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testClientID = "lunchorder-test"
+
+// fakeIssuer is a minimal OpenID Connect issuer serving discovery, JWKS and a
+// token endpoint that answers every code with an ID token built from claims
+type fakeIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// signingKey signs the ID tokens, normally key itself
+	signingKey *rsa.PrivateKey
+	claims     jwt.MapClaims
+	// codeVerifier is the PKCE verifier received by the last token request
+	codeVerifier string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &fakeIssuer{key: key, signingKey: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                issuer.server.URL,
+			"authorization_endpoint":                issuer.server.URL + "/authorize",
+			"token_endpoint":                        issuer.server.URL + "/token",
+			"jwks_uri":                              issuer.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		issuer.codeVerifier = r.PostForm.Get("code_verifier")
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, issuer.claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(issuer.signingKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+// issue sets the claims of the next ID token, on top of valid defaults
+func (f *fakeIssuer) issue(nonce string, extra jwt.MapClaims) {
+	f.claims = jwt.MapClaims{
+		"iss":   f.server.URL,
+		"aud":   testClientID,
+		"sub":   "subject-1",
+		"nonce": nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range extra {
+		f.claims[name] = value
+	}
+}
+
+func (f *fakeIssuer) provider(t *testing.T, trustEmail bool) *OIDCProvider {
+	t.Helper()
+
+	provider, err := NewOIDCProvider(context.Background(), config.OIDCConfig{
+		Name:         "fake",
+		IssuerURL:    f.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/auth/fake/callback",
+		TrustEmail:   trustEmail,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestOIDCExchangeVerifiesIDToken(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	provider := issuer.provider(t, false)
+
+	issuer.issue("nonce-1", jwt.MapClaims{"name": "Ada Lovelace", "given_name": "Ada", "family_name": "Lovelace"})
+	identity, err := provider.Exchange(context.Background(), "code", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+
+	if identity.Subject != "subject-1" || identity.Name != "Ada Lovelace" || identity.GivenName != "Ada" || identity.FamilyName != "Lovelace" {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+}
+
+func TestOIDCExchangeRejectsInvalidIDTokens(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		claims     jwt.MapClaims
+		signingKey *rsa.PrivateKey
+		want       string
+	}{
+		{name: "foreign signature", signingKey: otherKey, want: "failed to verify id token"},
+		{name: "wrong audience", claims: jwt.MapClaims{"aud": "someone-else"}, want: "failed to verify id token"},
+		{name: "wrong issuer", claims: jwt.MapClaims{"iss": "https://evil.example.com"}, want: "failed to verify id token"},
+		{name: "expired", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, want: "failed to verify id token"},
+		{name: "nonce mismatch", claims: jwt.MapClaims{"nonce": "replayed"}, want: "nonce mismatch"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issuer := newFakeIssuer(t)
+			provider := issuer.provider(t, false)
+			if test.signingKey != nil {
+				issuer.signingKey = test.signingKey
+			}
+
+			issuer.issue("nonce-1", test.claims)
+			_, err := provider.Exchange(context.Background(), "code", "nonce-1", "verifier-1")
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("expected error containing %q, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestOIDCPKCEVerifierIsForwarded(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	provider := issuer.provider(t, false)
+
+	authURL, err := url.Parse(provider.AuthCodeURL("state-1", "nonce-1", "verifier-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authURL.Query()
+
+	challenge := sha256.Sum256([]byte("verifier-1"))
+	if got := query.Get("code_challenge"); got != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+		t.Errorf("unexpected code_challenge %q", got)
+	}
+	if got := query.Get("code_challenge_method"); got != "S256" {
+		t.Errorf("unexpected code_challenge_method %q", got)
+	}
+	if query.Get("nonce") != "nonce-1" || query.Get("state") != "state-1" {
+		t.Errorf("nonce or state missing from %s", authURL)
+	}
+
+	issuer.issue("nonce-1", nil)
+	if _, err := provider.Exchange(context.Background(), "code", "nonce-1", "verifier-1"); err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if issuer.codeVerifier != "verifier-1" {
+		t.Errorf("token endpoint received code_verifier %q", issuer.codeVerifier)
+	}
+}
+
+func TestOIDCEmailMapping(t *testing.T) {
+	tests := []struct {
+		name         string
+		trustEmail   bool
+		claims       jwt.MapClaims
+		wantEmail    string
+		wantVerified bool
+		wantTrusted  bool
+	}{
+		{
+			name:         "verified",
+			claims:       jwt.MapClaims{"email": "ada@example.com", "email_verified": true},
+			wantEmail:    "ada@example.com",
+			wantVerified: true,
+			wantTrusted:  true,
+		},
+		{
+			name:      "not verified",
+			claims:    jwt.MapClaims{"email": "ada@example.com", "email_verified": false},
+			wantEmail: "ada@example.com",
+		},
+		{
+			name:       "not verified with trust email",
+			trustEmail: true,
+			claims:     jwt.MapClaims{"email": "ada@example.com", "email_verified": false},
+			wantEmail:  "ada@example.com",
+		},
+		{
+			name:      "claim missing",
+			claims:    jwt.MapClaims{"email": "ada@example.com"},
+			wantEmail: "ada@example.com",
+		},
+		{
+			name:        "claim missing with trust email is trusted but not verified",
+			trustEmail:  true,
+			claims:      jwt.MapClaims{"email": "ada@example.com"},
+			wantEmail:   "ada@example.com",
+			wantTrusted: true,
+		},
+		{
+			name:        "preferred_username is never an email",
+			trustEmail:  true,
+			claims:      jwt.MapClaims{"preferred_username": "ada@example.com"},
+			wantEmail:   "",
+			wantTrusted: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issuer := newFakeIssuer(t)
+			provider := issuer.provider(t, test.trustEmail)
+
+			issuer.issue("nonce-1", test.claims)
+			identity, err := provider.Exchange(context.Background(), "code", "nonce-1", "verifier-1")
+			if err != nil {
+				t.Fatalf("exchange failed: %v", err)
+			}
+
+			if identity.Email != test.wantEmail || identity.EmailVerified != test.wantVerified || identity.EmailTrusted != test.wantTrusted {
+				t.Errorf("got email %q verified %v trusted %v, want %q %v %v",
+					identity.Email, identity.EmailVerified, identity.EmailTrusted, test.wantEmail, test.wantVerified, test.wantTrusted)
+			}
+		})
+	}
+}
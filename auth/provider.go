@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrUnknownProvider = errors.New("unknown login provider")
+
+// Identity is the subset of a user's profile the app needs from any login provider
+type Identity struct {
+	Subject string
+	Email   string
+	// EmailVerified is only set when the provider itself vouched for the
+	// address; only then may the identity be linked to an existing account by email
+	EmailVerified bool
+	// EmailTrusted lets the address through the sign-in check, either because it
+	// is verified or because the provider is configured to trust its email claim
+	EmailTrusted bool
+	Name         string
+	GivenName    string
+	FamilyName   string
+	Picture      string
+}
+
+// Provider is an external identity provider the user can sign in with.
+// The nonce and PKCE verifier are generated per login attempt by the caller
+// and handed back unchanged to Exchange on the callback.
+type Provider interface {
+	Name() string
+	// Issuer identifies the provider when linking users; subjects are only unique per issuer
+	Issuer() string
+	AuthCodeURL(state string, nonce string, verifier string) string
+	Exchange(ctx context.Context, code string, nonce string, verifier string) (*Identity, error)
+}
+
+type Registry struct {
+	providers map[string]Provider
+	order     []string
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	registry := &Registry{providers: map[string]Provider{}}
+	for _, provider := range providers {
+		registry.Register(provider)
+	}
+	return registry
+}
+
+func (r *Registry) Register(provider Provider) {
+	if _, exists := r.providers[provider.Name()]; !exists {
+		r.order = append(r.order, provider.Name())
+	}
+	r.providers[provider.Name()] = provider
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// Names lists the registered providers in registration order
+func (r *Registry) Names() []string {
+	return append([]string{}, r.order...)
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	first := issuer.provider(t, false)
+	registry := NewRegistry(first)
+
+	second := issuer.provider(t, true)
+	registry.Register(second)
+
+	provider, err := registry.Get("fake")
+	if err != nil || provider != second {
+		t.Errorf("expected the later registration to replace the provider, got %v, %v", provider, err)
+	}
+	if names := registry.Names(); !reflect.DeepEqual(names, []string{"fake"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	if _, err := registry.Get("missing"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("expected ErrUnknownProvider, got %v", err)
+	}
+}
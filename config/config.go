@@ -0,0 +1,468 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+const defaultAllowedEmailDomains = "impact.com"
+
+const defaultCorsAllowedOrigins = "http://localhost:5173"
+
+// Config holds every setting the server and tools read at startup. See Load
+// for where the values come from.
+type Config struct {
+	// GinMode is debug, release or test; release turns on the production checks
+	GinMode  string
+	Server   ServerConfig
+	DevLogin bool
+	// CorsAllowedOrigins may call the API from the browser in addition to the app's own origin
+	CorsAllowedOrigins []string
+	// AllowedEmailDomains may sign in without an explicit allow rule
+	AllowedEmailDomains []string
+	// ScimToken enables the SCIM endpoints when set
+	ScimToken  string
+	Log        LogConfig
+	Cookies    CookieConfig
+	Database   DatabaseConfig
+	JWT        JWTConfig
+	Google     GoogleConfig
+	OIDC       []OIDCConfig
+	Encryption EncryptionConfig
+}
+
+type ServerConfig struct {
+	Port         int
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// MetricsPort serves /metrics apart from the app, so it is not public; 0 turns it off
+	MetricsPort int
+	// ShutdownDelay is how long /readyz fails after SIGTERM before the server
+	// stops accepting connections, so load balancers take the instance out first
+	ShutdownDelay time.Duration
+	// ShutdownTimeout is how long in-flight requests get to finish after that
+	ShutdownTimeout time.Duration
+}
+
+type LogConfig struct {
+	Level slog.Level
+	// Format is json or text
+	Format string
+}
+
+type CookieConfig struct {
+	Secure bool
+	// SameSite is lax, strict or none
+	SameSite string
+}
+
+type DatabaseConfig struct {
+	User            string
+	Password        string
+	Host            string
+	Port            int
+	Name            string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// JWTConfig holds the raw key settings, see auth.LoadKeyring for their format
+type JWTConfig struct {
+	Keys         []string
+	Secret       string
+	SigningKeyID string
+}
+
+type GoogleConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+type OIDCConfig struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// TrustEmail lets the email claim pass the sign-in check for issuers that
+	// never send email_verified. Such emails are still never used to link accounts.
+	TrustEmail bool
+}
+
+// EncryptionConfig holds the raw data key settings, see utils.LoadDataKeys
+// and utils.LoadKeyProvider for their format
+type EncryptionConfig struct {
+	Keys          []string
+	LegacyKey     string
+	KeyID         string
+	Provider      string
+	ProviderFile  string
+	ProviderURL   string
+	ProviderKeyID string
+	ProviderToken string
+	// LegacyHashes keeps blind-index lookups matching hashes computed with the
+	// data keys themselves, until verify finds none left
+	LegacyHashes bool
+}
+
+// Release reports whether the server runs in gin's release mode
+func (c *Config) Release() bool {
+	return c.GinMode == gin.ReleaseMode
+}
+
+// Load reads the configuration and validates it, returning every problem
+// found at once. Environment variables win over the .env file in the working
+// directory, which wins over the file named by CONFIG_FILE, which uses the
+// same KEY=value format.
+func Load() (*Config, error) {
+	values, err := readSources()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{values: values}
+	config := p.parse()
+	if err := errors.Join(p.errs...); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return config, nil
+}
+
+func readSources() (map[string]string, error) {
+	dotenv, err := godotenv.Read(".env")
+	if errors.Is(err, fs.ErrNotExist) {
+		dotenv = map[string]string{}
+	} else if err != nil {
+		return nil, fmt.Errorf(".env: %w", err)
+	}
+
+	environment := map[string]string{}
+	for _, entry := range os.Environ() {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			environment[name] = value
+		}
+	}
+
+	values := map[string]string{}
+
+	path := environment["CONFIG_FILE"]
+	if path == "" {
+		path = dotenv["CONFIG_FILE"]
+	}
+	if path != "" {
+		file, err := godotenv.Read(path)
+		if err != nil {
+			return nil, fmt.Errorf("CONFIG_FILE: %w", err)
+		}
+		maps.Copy(values, file)
+	}
+
+	maps.Copy(values, dotenv)
+	maps.Copy(values, environment)
+	return values, nil
+}
+
+type parser struct {
+	values map[string]string
+	errs   []error
+}
+
+func (p *parser) parse() *Config {
+	config := &Config{
+		GinMode: p.string("GIN_MODE", gin.DebugMode),
+		Server: ServerConfig{
+			Port:            p.int("PORT", 8080),
+			MetricsPort:     p.int("METRICS_PORT", 9091),
+			ReadTimeout:     p.duration("SERVER_READ_TIMEOUT", 15*time.Second),
+			WriteTimeout:    p.duration("SERVER_WRITE_TIMEOUT", 30*time.Second),
+			IdleTimeout:     p.duration("SERVER_IDLE_TIMEOUT", time.Minute),
+			ShutdownDelay:   p.duration("SHUTDOWN_DELAY", 5*time.Second),
+			ShutdownTimeout: p.duration("SHUTDOWN_TIMEOUT", 20*time.Second),
+		},
+		DevLogin:            p.bool("DEV_LOGIN", false),
+		CorsAllowedOrigins:  p.list("CORS_ALLOWED_ORIGINS", defaultCorsAllowedOrigins),
+		AllowedEmailDomains: p.list("ALLOWED_EMAIL_DOMAINS", defaultAllowedEmailDomains),
+		ScimToken:           p.string("SCIM_TOKEN", ""),
+		Log: LogConfig{
+			Level:  p.logLevel("LOG_LEVEL", slog.LevelInfo),
+			Format: p.string("LOG_FORMAT", "json"),
+		},
+		Database: DatabaseConfig{
+			User:            p.required("MYSQL_USER"),
+			Password:        p.string("MYSQL_PASSWORD", ""),
+			Host:            p.required("MYSQL_HOST"),
+			Port:            p.int("MYSQL_PORT", 3306),
+			Name:            p.required("MYSQL_DATABASE"),
+			MaxOpenConns:    p.int("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:    p.int("DB_MAX_IDLE_CONNS", 5),
+			ConnMaxLifetime: p.duration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+			ConnMaxIdleTime: p.duration("DB_CONN_MAX_IDLE_TIME", time.Minute),
+		},
+		JWT: JWTConfig{
+			Keys:         p.list("JWT_KEYS", ""),
+			Secret:       p.string("JWT_SECRET", ""),
+			SigningKeyID: p.string("JWT_SIGNING_KEY_ID", ""),
+		},
+		Google: GoogleConfig{
+			ClientID:     p.string("GOOGLE_CLIENT_ID", ""),
+			ClientSecret: p.string("GOOGLE_CLIENT_SECRET", ""),
+			RedirectURL:  p.string("GOOGLE_REDIRECT_URL", ""),
+		},
+		Encryption: EncryptionConfig{
+			Keys:          p.list("DATA_ENCRYPTION_KEYS", ""),
+			LegacyKey:     p.string("DATA_ENCRYPTION_KEY", ""),
+			KeyID:         p.string("DATA_ENCRYPTION_KEY_ID", ""),
+			LegacyHashes:  p.bool("DATA_ENCRYPTION_LEGACY_HASHES", true),
+			Provider:      p.string("KEY_PROVIDER", "env"),
+			ProviderFile:  p.string("KEY_PROVIDER_FILE", ""),
+			ProviderURL:   p.string("KEY_PROVIDER_URL", ""),
+			ProviderKeyID: p.string("KEY_PROVIDER_KEY_ID", ""),
+			ProviderToken: p.string("KEY_PROVIDER_TOKEN", ""),
+		},
+	}
+
+	if config.GinMode != gin.DebugMode && config.GinMode != gin.ReleaseMode && config.GinMode != gin.TestMode {
+		p.fail("GIN_MODE must be debug, release or test")
+	}
+	if config.DevLogin && config.Release() {
+		p.fail("DEV_LOGIN must not be enabled when GIN_MODE=release")
+	}
+	p.checkServer(config.Server)
+	for _, origin := range config.CorsAllowedOrigins {
+		if !validOrigin(origin) {
+			p.fail("CORS_ALLOWED_ORIGINS entry %q must look like https://host[:port]", origin)
+		}
+	}
+
+	if config.Log.Format != "json" && config.Log.Format != "text" {
+		p.fail("LOG_FORMAT must be json or text")
+	}
+
+	config.Cookies = p.cookies(config.Release())
+	p.checkDatabase(config.Database)
+	p.checkGoogle(config.Google)
+	config.OIDC = p.oidcProviders()
+	p.checkEncryption(config.Encryption)
+
+	return config
+}
+
+// cookies reads COOKIE_SECURE, which defaults to true in release mode, and COOKIE_SAMESITE
+func (p *parser) cookies(release bool) CookieConfig {
+	cookies := CookieConfig{
+		Secure:   p.bool("COOKIE_SECURE", release),
+		SameSite: strings.ToLower(p.string("COOKIE_SAMESITE", "lax")),
+	}
+
+	switch cookies.SameSite {
+	case "lax", "strict":
+	case "none":
+		// Browsers drop SameSite=None cookies that are not Secure
+		if !cookies.Secure {
+			p.fail("COOKIE_SAMESITE=none requires COOKIE_SECURE=true")
+		}
+	default:
+		p.fail("COOKIE_SAMESITE must be lax, strict or none")
+	}
+
+	return cookies
+}
+
+func (p *parser) checkServer(server ServerConfig) {
+	if server.Port < 1 || server.Port > 65535 {
+		p.fail("PORT must be between 1 and 65535")
+	}
+	if server.MetricsPort < 0 || server.MetricsPort > 65535 || server.MetricsPort == server.Port {
+		p.fail("METRICS_PORT must be 0 or a port between 1 and 65535 other than PORT")
+	}
+	if server.ReadTimeout <= 0 || server.WriteTimeout <= 0 || server.IdleTimeout <= 0 || server.ShutdownTimeout <= 0 {
+		p.fail("SERVER_READ_TIMEOUT, SERVER_WRITE_TIMEOUT, SERVER_IDLE_TIMEOUT and SHUTDOWN_TIMEOUT must be positive")
+	}
+	if server.ShutdownDelay < 0 {
+		p.fail("SHUTDOWN_DELAY must not be negative")
+	}
+}
+
+func (p *parser) checkDatabase(database DatabaseConfig) {
+	if database.Port < 1 || database.Port > 65535 {
+		p.fail("MYSQL_PORT must be between 1 and 65535")
+	}
+	if database.MaxOpenConns < 1 {
+		p.fail("DB_MAX_OPEN_CONNS must be at least 1")
+	}
+	if database.MaxIdleConns < 0 || database.MaxIdleConns > database.MaxOpenConns {
+		p.fail("DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS")
+	}
+	if database.ConnMaxLifetime < 0 || database.ConnMaxIdleTime < 0 {
+		p.fail("DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME must not be negative")
+	}
+}
+
+// checkGoogle accepts Google being left unconfigured, but not half configured
+func (p *parser) checkGoogle(google GoogleConfig) {
+	set := 0
+	for _, value := range []string{google.ClientID, google.ClientSecret, google.RedirectURL} {
+		if value != "" {
+			set++
+		}
+	}
+	if set != 0 && set != 3 {
+		p.fail("GOOGLE_CLIENT_ID, GOOGLE_CLIENT_SECRET and GOOGLE_REDIRECT_URL must be set together")
+	}
+}
+
+// oidcProviders reads the issuers listed in OIDC_PROVIDERS, each configured
+// through OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL and
+// optionally _SCOPES and _TRUST_EMAIL
+func (p *parser) oidcProviders() []OIDCConfig {
+	var providers []OIDCConfig
+	for _, name := range p.list("OIDC_PROVIDERS", "") {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		providers = append(providers, OIDCConfig{
+			Name:         name,
+			IssuerURL:    p.required(prefix + "ISSUER"),
+			ClientID:     p.required(prefix + "CLIENT_ID"),
+			ClientSecret: p.string(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  p.required(prefix + "REDIRECT_URL"),
+			Scopes:       p.list(prefix+"SCOPES", ""),
+			TrustEmail:   p.bool(prefix+"TRUST_EMAIL", false),
+		})
+	}
+	return providers
+}
+
+func (p *parser) checkEncryption(encryption EncryptionConfig) {
+	if len(encryption.Keys) == 0 && encryption.LegacyKey == "" {
+		p.fail("DATA_ENCRYPTION_KEYS or DATA_ENCRYPTION_KEY is required")
+	}
+
+	switch encryption.Provider {
+	case "env":
+	case "file":
+		if encryption.ProviderFile == "" {
+			p.fail("KEY_PROVIDER_FILE is required when KEY_PROVIDER=file")
+		}
+	case "http":
+		if encryption.ProviderURL == "" {
+			p.fail("KEY_PROVIDER_URL is required when KEY_PROVIDER=http")
+		}
+	default:
+		p.fail("KEY_PROVIDER must be env, file or http")
+	}
+}
+
+func (p *parser) fail(format string, args ...any) {
+	p.errs = append(p.errs, fmt.Errorf(format, args...))
+}
+
+// string returns the value, or fallback when the variable is unset or empty
+func (p *parser) string(name string, fallback string) string {
+	value := strings.TrimSpace(p.values[name])
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func (p *parser) required(name string) string {
+	value := p.string(name, "")
+	if value == "" {
+		p.fail("%s is required", name)
+	}
+	return value
+}
+
+func (p *parser) bool(name string, fallback bool) bool {
+	value := p.string(name, "")
+	if value == "" {
+		return fallback
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		p.fail("%s must be true or false", name)
+		return fallback
+	}
+	return result
+}
+
+func (p *parser) int(name string, fallback int) int {
+	value := p.string(name, "")
+	if value == "" {
+		return fallback
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		p.fail("%s must be a whole number", name)
+		return fallback
+	}
+	return result
+}
+
+func (p *parser) duration(name string, fallback time.Duration) time.Duration {
+	value := p.string(name, "")
+	if value == "" {
+		return fallback
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		p.fail("%s must be a duration such as 30s or 5m", name)
+		return fallback
+	}
+	return result
+}
+
+func (p *parser) logLevel(name string, fallback slog.Level) slog.Level {
+	value := p.string(name, "")
+	if value == "" {
+		return fallback
+	}
+	var result slog.Level
+	if err := result.UnmarshalText([]byte(value)); err != nil {
+		p.fail("%s must be debug, info, warn or error", name)
+		return fallback
+	}
+	return result
+}
+
+// list splits a comma-separated value, dropping empty entries. Unlike the
+// other values, set but empty counts as set, so ALLOWED_EMAIL_DOMAINS= can
+// turn the default off.
+func (p *parser) list(name string, fallback string) []string {
+	value, found := p.values[name]
+	if !found {
+		value = fallback
+	}
+
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func validOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
@@ -35,3 +35,13 @@ export interface MealPreference {
   description: string;
   selected: boolean;
 }
+
+export interface AdminUser {
+  id: number;
+  createdAt: string;
+  handle: string;
+  name: string;
+  email: string | null;
+  isAdmin: boolean;
+  active: boolean;
+}
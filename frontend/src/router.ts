@@ -3,6 +3,7 @@ import HomeScreen from './components/HomeScreen.vue';
 import GiveMealScreen from './components/GiveMealScreen.vue';
 import ReceiveMealScreen from './components/ReceiveMealScreen.vue';
 import AdminScreen from './components/AdminScreen.vue';
+import AdminUsersScreen from './components/AdminUsersScreen.vue';
 import DonationRequestScreen from './components/DonationRequestScreen.vue';
 import LoginScreen from './components/LoginScreen.vue';
 import NotFound from './components/errors/404.vue';
@@ -17,6 +18,7 @@ const routes = [
   { path: '/receive-meal', component: ReceiveMealScreen, meta: { requiresAuth: true } },
   { path: '/donation-request', component: DonationRequestScreen, meta: { requiresAuth: true } },
   { path: '/admin', component: AdminScreen, meta: { requiresAuth: true, requiresAdmin: true } },
+  { path: '/admin/users', component: AdminUsersScreen, meta: { requiresAuth: true, requiresAdmin: true } },
   { path: '/401', component: Unauthorized },
   { path: '/403', component: Forbidden },
   { path: '/:pathMatch(.*)*', component: NotFound },
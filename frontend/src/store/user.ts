@@ -1,13 +1,32 @@
 import { reactive } from 'vue';
 
+interface UserPreferences {
+  notificationChannels: string[];
+  dietaryProfile: string[];
+  defaultPickupLocation: string | null;
+  timezone: string | null;
+}
+
+interface Impersonation {
+  impersonatorId: number;
+  impersonatorName: string;
+  userId: number;
+  reason: string;
+  readOnly: boolean;
+  expiresAt: string;
+}
+
 interface User {
   id: number;
+  handle: string;
   name: string;
   email: string;
   firstName: string;
   lastName: string;
   avatarUrl: string;
   isAdmin: boolean;
+  preferences: UserPreferences;
+  impersonation: Impersonation | null;
 }
 
 export const userStore = reactive({
@@ -28,6 +47,15 @@ export const userStore = reactive({
       this.isAuthenticated = false;
     }
   },
+  async endImpersonation() {
+    try {
+      await fetch('/Api/Me/Impersonation', { method: 'DELETE' });
+    } catch (e) {
+      console.error(e);
+    } finally {
+      window.location.href = '/admin/users';
+    }
+  },
   async logout() {
       try {
           await fetch('/auth/logout', { method: 'POST' });
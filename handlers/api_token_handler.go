@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"lunchorder/models"
+	"lunchorder/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ApiTokenHandler struct {
+	apiTokenService *service.ApiTokenService
+}
+
+func NewApiTokenHandler(apiTokenService *service.ApiTokenService) *ApiTokenHandler {
+	return &ApiTokenHandler{apiTokenService: apiTokenService}
+}
+
+func (h *ApiTokenHandler) HandleCreateApiToken(context *gin.Context) {
+	user, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      "unauthorized",
+		})
+		return
+	}
+
+	var tokenRequest models.ApiTokenCreateRequest
+	err := context.BindJSON(&tokenRequest)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	created, err := h.apiTokenService.CreateApiToken(user.ID, &tokenRequest)
+
+	if errors.Is(err, service.ErrInvalidApiTokenRequest) || errors.Is(err, service.ErrInvalidApiTokenExpiry) {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+		Data:       created,
+	})
+}
+
+func (h *ApiTokenHandler) HandleGetApiTokens(context *gin.Context) {
+	user, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      "unauthorized",
+		})
+		return
+	}
+
+	tokens, err := h.apiTokenService.GetApiTokens(user.ID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+		Data:       tokens,
+	})
+}
+
+func (h *ApiTokenHandler) HandleRevokeApiToken(context *gin.Context) {
+	user, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      "unauthorized",
+		})
+		return
+	}
+
+	id, err := strconv.ParseUint(context.Param("id"), 10, 32)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      "invalid token id",
+		})
+		return
+	}
+
+	err = h.apiTokenService.RevokeApiToken(uint(id), user.ID)
+
+	if errors.Is(err, service.ErrApiTokenNotFound) {
+		context.JSON(http.StatusNotFound, models.ApiResult{
+			StatusCode: http.StatusNotFound,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+	})
+}
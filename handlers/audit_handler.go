@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"lunchorder/models"
+	"lunchorder/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultAuditLogLimit is how many entries GET /Api/Audit returns without ?limit=
+const defaultAuditLogLimit = 100
+
+type AuditHandler struct {
+	auditService *service.AuditService
+}
+
+func NewAuditHandler(auditService *service.AuditService) *AuditHandler {
+	return &AuditHandler{auditService: auditService}
+}
+
+func (h *AuditHandler) HandleGetAuditLog(context *gin.Context) {
+	limit, err := strconv.Atoi(context.DefaultQuery("limit", strconv.Itoa(defaultAuditLogLimit)))
+	if err != nil || limit < 1 || limit > 1000 {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      "limit must be between 1 and 1000",
+		})
+		return
+	}
+
+	entries, err := h.auditService.GetAuditLog(limit)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+		Data:       entries,
+	})
+}
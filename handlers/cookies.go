@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"lunchorder/config"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CookieSettings holds the attributes applied to every cookie the app sets
+type CookieSettings struct {
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// NewCookieSettings applies the configured SameSite mode, which config.Load
+// has already checked is "lax", "strict" or "none"
+func NewCookieSettings(config config.CookieConfig) CookieSettings {
+	settings := CookieSettings{Secure: config.Secure, SameSite: http.SameSiteLaxMode}
+
+	switch config.SameSite {
+	case "strict":
+		settings.SameSite = http.SameSiteStrictMode
+	case "none":
+		settings.SameSite = http.SameSiteNoneMode
+	}
+
+	return settings
+}
+
+func (s CookieSettings) set(c *gin.Context, name string, value string, maxAge int) {
+	c.SetSameSite(s.SameSite)
+	c.SetCookie(name, value, maxAge, "/", "", s.Secure, true)
+}
+
+func (s CookieSettings) clear(c *gin.Context, name string) {
+	s.set(c, name, "", -1)
+}
+
+// oauth returns the settings for cookies that must survive the identity
+// provider's cross-site redirect back to the callback. Strict cookies would
+// not be sent on that navigation, so Strict is relaxed to Lax.
+func (s CookieSettings) oauth() CookieSettings {
+	if s.SameSite == http.SameSiteStrictMode {
+		s.SameSite = http.SameSiteLaxMode
+	}
+	return s
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"log/slog"
+	"lunchorder/auth"
+	"lunchorder/repository"
+	"lunchorder/service"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// devIssuer is the issuer recorded in user_identities for users created through dev login
+const devIssuer = "dev"
+
+var devLoginTemplate = template.Must(template.New("dev-login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Dev Login</title></head>
+<body style="font-family: sans-serif; max-width: 32rem; margin: 2rem auto;">
+<h1>Dev Login</h1>
+<p>Local development only. Pick an existing user or create a test user.</p>
+{{if .Error}}<p style="color: red;">{{.Error}}</p>{{end}}
+<h2>Existing users</h2>
+{{range .Users}}
+<form method="POST" action="/auth/dev/login">
+  <input type="hidden" name="userId" value="{{.ID}}">
+  <button type="submit">{{.Name}}{{if .Email}} ({{.Email}}){{end}}{{if .IsAdmin}} [admin]{{end}}</button>
+</form>
+{{else}}
+<p>No users yet.</p>
+{{end}}
+<h2>New test user</h2>
+<form method="POST" action="/auth/dev/login">
+  <p><label>Name <input name="name" required></label></p>
+  <p><label>Email <input name="email" type="email" required></label></p>
+  <p><label><input name="admin" type="checkbox" value="true"> Admin</label></p>
+  <button type="submit">Create and sign in</button>
+</form>
+</body>
+</html>
+`))
+
+type devLoginUser struct {
+	ID      uint
+	Name    string
+	Email   string
+	IsAdmin bool
+}
+
+// DevAuthHandler signs developers in as any user without an external identity provider.
+// It must never be routed in release mode.
+type DevAuthHandler struct {
+	userRepo *repository.UserRepository
+	sessions *sessionIssuer
+}
+
+func NewDevAuthHandler(userRepo *repository.UserRepository, sessionService *service.SessionService, keyring *auth.Keyring, cookies CookieSettings) *DevAuthHandler {
+	return &DevAuthHandler{
+		userRepo: userRepo,
+		sessions: newSessionIssuer(userRepo, sessionService, keyring, cookies),
+	}
+}
+
+func (h *DevAuthHandler) HandleDevLoginPage(c *gin.Context) {
+	h.renderLoginPage(c, http.StatusOK, "")
+}
+
+func (h *DevAuthHandler) HandleDevLogin(c *gin.Context) {
+	var user *repository.User
+
+	if userID := c.PostForm("userId"); userID != "" {
+		id, err := strconv.ParseUint(userID, 10, 32)
+		if err != nil {
+			h.renderLoginPage(c, http.StatusBadRequest, "invalid user id")
+			return
+		}
+
+		user, err = h.userRepo.GetUserByID(uint(id))
+		if err != nil {
+			h.renderLoginPage(c, http.StatusNotFound, "user not found")
+			return
+		}
+	} else {
+		name := strings.TrimSpace(c.PostForm("name"))
+		email := strings.TrimSpace(c.PostForm("email"))
+		if name == "" || email == "" {
+			h.renderLoginPage(c, http.StatusBadRequest, "name and email are required")
+			return
+		}
+
+		isAdmin := c.PostForm("admin") == "true"
+		user = &repository.User{
+			Name:    name,
+			Email:   &email,
+			IsAdmin: isAdmin,
+		}
+
+		if err := h.userRepo.UpsertUserWithIdentity(user, devIssuer, devIssuer, email, true); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error creating dev user", "error", err)
+			h.renderLoginPage(c, http.StatusInternalServerError, "failed to save user")
+			return
+		}
+
+		// The upsert leaves is_admin alone for existing users
+		if err := h.userRepo.SetUserAdmin(user.ID, isAdmin); err != nil {
+			h.renderLoginPage(c, http.StatusInternalServerError, "failed to save user")
+			return
+		}
+	}
+
+	err := h.sessions.start(c, user)
+	if errors.Is(err, service.ErrUserDeactivated) {
+		h.renderLoginPage(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		h.renderLoginPage(c, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/")
+}
+
+func (h *DevAuthHandler) renderLoginPage(c *gin.Context, status int, errorMessage string) {
+	users, err := h.userRepo.GetUsers()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error listing users for dev login", "error", err)
+	}
+
+	var listed []devLoginUser
+	for _, user := range users {
+		u := devLoginUser{ID: user.ID, Name: user.Name, IsAdmin: user.IsAdmin}
+		if user.Email != nil {
+			u.Email = *user.Email
+		}
+		listed = append(listed, u)
+	}
+
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	err = devLoginTemplate.Execute(c.Writer, gin.H{
+		"Users": listed,
+		"Error": errorMessage,
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Error rendering dev login page", "error", err)
+	}
+}
@@ -1,24 +1,34 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"lunchorder/auth"
 	"lunchorder/constants"
 	"lunchorder/models"
 	"lunchorder/service"
+	"lunchorder/utils"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 )
 
+const pickupTokenPurpose = "pickup"
+
 type DonationHandler struct {
 	donationService        *service.DonationService
 	donationRequestService *service.DonationRequestService
+	keyring                *auth.Keyring
 }
 
-func NewDonationHandler(donationService *service.DonationService, donationRequestService *service.DonationRequestService) *DonationHandler {
+func NewDonationHandler(donationService *service.DonationService, donationRequestService *service.DonationRequestService, keyring *auth.Keyring) *DonationHandler {
 	return &DonationHandler{
 		donationService:        donationService,
 		donationRequestService: donationRequestService,
+		keyring:                keyring,
 	}
 }
 
@@ -33,6 +43,12 @@ func (h *DonationHandler) HandleDonateMeal(context *gin.Context) {
 		return
 	}
 
+	donorID, ok := actingUserID(context, donationRequest.DonorID)
+	if !ok {
+		return
+	}
+	donationRequest.DonorID = donorID
+
 	err = h.donationService.CreateDonation(&donationRequest)
 
 	if err != nil {
@@ -82,7 +98,13 @@ func (h *DonationHandler) HandleDonationClaim(context *gin.Context) {
 		return
 	}
 
-	err = h.donationService.ClaimDonation(&donationClaim)
+	userID, ok := actingUserID(context, donationClaim.UserID)
+	if !ok {
+		return
+	}
+	donationClaim.UserID = userID
+
+	err = h.donationService.ClaimDonation(context.Request.Context(), &donationClaim)
 
 	if err != nil {
 		context.JSON(http.StatusBadRequest, models.ApiResult{
@@ -97,18 +119,15 @@ func (h *DonationHandler) HandleDonationClaim(context *gin.Context) {
 	})
 }
 
+// HandleGetDonationClaim returns the caller's claimed donation, or with
+// ?userId= another user's for admins
 func (h *DonationHandler) HandleGetDonationClaim(context *gin.Context) {
-	claimantName := context.Query("name")
-
-	if claimantName == "" {
-		context.JSON(http.StatusBadRequest, models.ApiResult{
-			StatusCode: http.StatusBadRequest,
-			Error:      "name is a required query parameter",
-		})
+	userID, ok := actingUserIDQuery(context)
+	if !ok {
 		return
 	}
 
-	claimed, err := h.donationService.GetDonationClaimByClaimantName(claimantName)
+	claimed, err := h.donationService.GetDonationClaimByRecipientID(userID)
 
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, models.ApiResult{
@@ -154,3 +173,175 @@ func (h *DonationHandler) HandleGetDonationSummary(context *gin.Context) {
 		Data:       donationClaimSummaries,
 	})
 }
+
+func (h *DonationHandler) HandleGetDonationClaimQR(context *gin.Context) {
+	user, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      "unauthorized",
+		})
+		return
+	}
+
+	donationID, err := strconv.ParseUint(context.Query("donationId"), 10, 32)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      "donationId is a required query parameter",
+		})
+		return
+	}
+
+	donation, err := h.donationService.GetClaimedDonation(uint(donationID), user.ID)
+	if errors.Is(err, service.ErrDonationNotFound) || errors.Is(err, service.ErrDonationRecipientMismatch) {
+		context.JSON(http.StatusNotFound, models.ApiResult{
+			StatusCode: http.StatusNotFound,
+			Error:      service.ErrDonationNotFound.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrDonationAlreadyCollected) {
+		context.JSON(http.StatusConflict, models.ApiResult{
+			StatusCode: http.StatusConflict,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	token, err := h.generatePickupToken(donation.ID, user.ID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      "failed to generate pickup token",
+		})
+		return
+	}
+
+	if context.Query("format") == "svg" {
+		svg, err := utils.QRCodeSVG(token)
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, models.ApiResult{
+				StatusCode: http.StatusInternalServerError,
+				Error:      err.Error(),
+			})
+			return
+		}
+		context.Header("Cache-Control", "no-store")
+		context.Data(http.StatusOK, "image/svg+xml", svg)
+		return
+	}
+
+	png, err := utils.QRCodePNG(token, 256)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+	context.Header("Cache-Control", "no-store")
+	context.Data(http.StatusOK, "image/png", png)
+}
+
+func (h *DonationHandler) HandleCollectDonation(context *gin.Context) {
+	var collectRequest models.DonationCollectRequest
+	err := context.BindJSON(&collectRequest)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	donationID, recipientID, err := h.parsePickupToken(collectRequest.Token)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      "invalid pickup code",
+		})
+		return
+	}
+
+	collected, err := h.donationService.CollectDonation(context.Request.Context(), donationID, recipientID)
+
+	if errors.Is(err, service.ErrDonationNotFound) {
+		context.JSON(http.StatusNotFound, models.ApiResult{
+			StatusCode: http.StatusNotFound,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrDonationRecipientMismatch) {
+		context.JSON(http.StatusForbidden, models.ApiResult{
+			StatusCode: http.StatusForbidden,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrDonationAlreadyCollected) {
+		context.JSON(http.StatusConflict, models.ApiResult{
+			StatusCode: http.StatusConflict,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+		Data:       collected,
+	})
+}
+
+func (h *DonationHandler) generatePickupToken(donationID uint, recipientID uint) (string, error) {
+	claims := jwt.MapClaims{
+		"purpose":      pickupTokenPurpose,
+		"donation_id":  donationID,
+		"recipient_id": recipientID,
+		"exp":          time.Now().Add(time.Hour * 24).Unix(),
+	}
+	return h.keyring.Sign(claims)
+}
+
+func (h *DonationHandler) parsePickupToken(tokenString string) (uint, uint, error) {
+	claims, err := h.keyring.Parse(tokenString)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid pickup token: %v", err)
+	}
+
+	if claims["purpose"] != pickupTokenPurpose {
+		return 0, 0, fmt.Errorf("invalid pickup token claims")
+	}
+
+	donationID, ok := claims["donation_id"].(float64)
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid donation id in pickup token")
+	}
+
+	recipientID, ok := claims["recipient_id"].(float64)
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid recipient id in pickup token")
+	}
+
+	return uint(donationID), uint(recipientID), nil
+}
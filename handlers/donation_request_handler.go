@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"lunchorder/models"
 	"lunchorder/service"
 	"net/http"
@@ -27,14 +28,11 @@ func (h *DonationRequestHandler) HandleCreateDonationRequest(context *gin.Contex
 		return
 	}
 
-	// Validate request data
-	if donationRequestData.RequesterName == "" {
-		context.JSON(http.StatusBadRequest, models.ApiResult{
-			StatusCode: http.StatusBadRequest,
-			Error:      "requesterName is required",
-		})
+	requesterID, ok := actingUserID(context, donationRequestData.RequesterID)
+	if !ok {
 		return
 	}
+	donationRequestData.RequesterID = requesterID
 
 	if len(donationRequestData.MealIds) == 0 {
 		context.JSON(http.StatusBadRequest, models.ApiResult{
@@ -77,19 +75,25 @@ func (h *DonationRequestHandler) HandleGetPendingDonationRequests(context *gin.C
 	})
 }
 
+// HandleGetUserDonationRequests returns the caller's requests, or with
+// ?userId= another user's for admins
 func (h *DonationRequestHandler) HandleGetUserDonationRequests(context *gin.Context) {
-	userName := context.Query("name")
-	if userName == "" {
-		context.JSON(http.StatusBadRequest, models.ApiResult{
-			StatusCode: http.StatusBadRequest,
-			Error:      "name is a required query parameter",
-		})
+	userID, ok := actingUserIDQuery(context)
+	if !ok {
 		return
 	}
 
 	date := context.Query("date")
 
-	requests, err := h.donationRequestService.GetDonationRequestsByRequesterName(userName, date)
+	requests, err := h.donationRequestService.GetDonationRequestsByRequesterID(userID, date)
+	if errors.Is(err, service.ErrUserNotFound) {
+		context.JSON(http.StatusNotFound, models.ApiResult{
+			StatusCode: http.StatusNotFound,
+			Error:      err.Error(),
+		})
+		return
+	}
+
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, models.ApiResult{
 			StatusCode: http.StatusInternalServerError,
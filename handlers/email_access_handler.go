@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"lunchorder/models"
+	"lunchorder/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EmailAccessHandler struct {
+	emailAccessService *service.EmailAccessService
+}
+
+func NewEmailAccessHandler(emailAccessService *service.EmailAccessService) *EmailAccessHandler {
+	return &EmailAccessHandler{emailAccessService: emailAccessService}
+}
+
+func (h *EmailAccessHandler) HandleGetEmailAccessRules(context *gin.Context) {
+	rules, err := h.emailAccessService.GetRules()
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+		Data:       rules,
+	})
+}
+
+func (h *EmailAccessHandler) HandleSetEmailAccessRule(context *gin.Context) {
+	var ruleRequest models.EmailAccessRuleRequest
+	err := context.BindJSON(&ruleRequest)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	err = h.emailAccessService.SetRule(&ruleRequest)
+
+	if errors.Is(err, service.ErrInvalidEmailRule) || errors.Is(err, service.ErrInvalidEmail) {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+	})
+}
+
+func (h *EmailAccessHandler) HandleDeleteEmailAccessRule(context *gin.Context) {
+	id, err := strconv.ParseUint(context.Param("id"), 10, 32)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      "invalid rule id",
+		})
+		return
+	}
+
+	err = h.emailAccessService.DeleteRule(uint(id))
+
+	if errors.Is(err, service.ErrEmailRuleNotFound) {
+		context.JSON(http.StatusNotFound, models.ApiResult{
+			StatusCode: http.StatusNotFound,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+	})
+}
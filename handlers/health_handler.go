@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"lunchorder/service"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout bounds the database checks, so a hung database fails the probe instead of stalling it
+const readinessTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	healthService *service.HealthService
+}
+
+func NewHealthHandler(healthService *service.HealthService) *HealthHandler {
+	return &HealthHandler{healthService: healthService}
+}
+
+// HandleHealthz reports that the process is up. It checks nothing else, so a
+// database outage does not get every instance restarted.
+func (h *HealthHandler) HandleHealthz(context *gin.Context) {
+	context.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// HandleReadyz reports whether this instance should receive traffic
+func (h *HealthHandler) HandleReadyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	err := h.healthService.Ready(ctx)
+	if errors.Is(err, service.ErrDatabaseUnavailable) {
+		// The cause may name the database host, so it only goes to the log
+		slog.WarnContext(ctx, "Readiness check failed", "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": service.ErrDatabaseUnavailable.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"lunchorder/auth"
+	"lunchorder/models"
+	"lunchorder/repository"
+	"lunchorder/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ImpersonationHandler struct {
+	impersonationService *service.ImpersonationService
+	sessions             *sessionIssuer
+}
+
+func NewImpersonationHandler(impersonationService *service.ImpersonationService, userRepo *repository.UserRepository, sessionService *service.SessionService, keyring *auth.Keyring, cookies CookieSettings) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		impersonationService: impersonationService,
+		sessions:             newSessionIssuer(userRepo, sessionService, keyring, cookies),
+	}
+}
+
+// HandleStartImpersonation lets the signed-in admin act as another user for
+// service.ImpersonationTTL. The browser's access token is swapped for an
+// impersonation token; the admin's own session resumes when it ends.
+func (h *ImpersonationHandler) HandleStartImpersonation(context *gin.Context) {
+	admin, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      "unauthorized",
+		})
+		return
+	}
+
+	id, ok := userIDParam(context)
+	if !ok {
+		return
+	}
+
+	var request models.ImpersonationRequest
+	if err := context.BindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	impersonation, user, err := h.impersonationService.StartImpersonation(admin, context.GetString("sessionID"), id, &request)
+	if errors.Is(err, service.ErrImpersonationReasonRequired) || errors.Is(err, service.ErrImpersonateSelf) {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrUserNotFound) {
+		context.JSON(http.StatusNotFound, models.ApiResult{
+			StatusCode: http.StatusNotFound,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrUserDeactivated) {
+		context.JSON(http.StatusConflict, models.ApiResult{
+			StatusCode: http.StatusConflict,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err := h.sessions.impersonate(context, user, impersonation); err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      "failed to generate token",
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+		Data:       service.ToImpersonationResponse(impersonation, admin),
+	})
+}
+
+// HandleEndImpersonation ends the current impersonation and signs the admin
+// back into their own session
+func (h *ImpersonationHandler) HandleEndImpersonation(context *gin.Context) {
+	impersonation, _, ok := currentImpersonation(context)
+	if !ok {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      service.ErrNotImpersonating.Error(),
+		})
+		return
+	}
+
+	if err := h.impersonationService.EndImpersonation(impersonation); err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if _, _, err := h.sessions.refresh(context); err != nil {
+		h.sessions.clearCookies(context)
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      service.ErrInvalidRefreshToken.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+	})
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lunchorder/models"
+	"lunchorder/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PrivacyHandler struct {
+	privacyService *service.PrivacyService
+	cookies        CookieSettings
+}
+
+func NewPrivacyHandler(privacyService *service.PrivacyService, cookies CookieSettings) *PrivacyHandler {
+	return &PrivacyHandler{
+		privacyService: privacyService,
+		cookies:        cookies,
+	}
+}
+
+// HandleExportMe returns everything stored about the signed-in user, as JSON
+// or, with ?format=zip, as a ZIP bundle of one JSON file per section
+func (h *PrivacyHandler) HandleExportMe(context *gin.Context) {
+	user, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      "unauthorized",
+		})
+		return
+	}
+
+	h.export(context, user.ID)
+}
+
+// HandleEraseMe anonymises the signed-in user and signs them out
+func (h *PrivacyHandler) HandleEraseMe(context *gin.Context) {
+	user, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      "unauthorized",
+		})
+		return
+	}
+
+	if !h.erase(context, user.ID) {
+		return
+	}
+
+	h.cookies.clear(context, "auth_token")
+	h.cookies.clear(context, "refresh_token")
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+	})
+}
+
+func (h *PrivacyHandler) HandleGetPrivacySettings(context *gin.Context) {
+	user, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      "unauthorized",
+		})
+		return
+	}
+
+	settings, err := h.privacyService.GetPrivacySettings(user.ID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+		Data:       settings,
+	})
+}
+
+func (h *PrivacyHandler) HandleUpdatePrivacySettings(context *gin.Context) {
+	user, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      "unauthorized",
+		})
+		return
+	}
+
+	var settings models.PrivacySettings
+	if err := context.BindJSON(&settings); err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	err := h.privacyService.UpdatePrivacySettings(user.ID, &settings)
+	if errors.Is(err, service.ErrInvalidNameVisibility) {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+		Data:       settings,
+	})
+}
+
+func (h *PrivacyHandler) HandleExportUser(context *gin.Context) {
+	id, ok := userIDParam(context)
+	if !ok {
+		return
+	}
+
+	h.export(context, id)
+}
+
+func (h *PrivacyHandler) HandleEraseUser(context *gin.Context) {
+	id, ok := userIDParam(context)
+	if !ok {
+		return
+	}
+
+	if !h.erase(context, id) {
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+	})
+}
+
+func (h *PrivacyHandler) export(context *gin.Context, userID uint) {
+	export, err := h.privacyService.ExportUserData(userID)
+
+	if errors.Is(err, service.ErrUserNotFound) {
+		context.JSON(http.StatusNotFound, models.ApiResult{
+			StatusCode: http.StatusNotFound,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if context.Query("format") != "zip" {
+		context.JSON(http.StatusOK, models.ApiResult{
+			StatusCode: http.StatusOK,
+			Data:       export,
+		})
+		return
+	}
+
+	bundle, err := exportZip(export)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("lunchorder-export-%d-%s.zip", userID, export.ExportedAt.Format("20060102"))
+	context.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	context.Data(http.StatusOK, "application/zip", bundle)
+}
+
+// erase anonymises the user, writing the error response and returning false if that fails
+func (h *PrivacyHandler) erase(context *gin.Context, userID uint) bool {
+	err := h.privacyService.EraseUser(userID)
+
+	if errors.Is(err, service.ErrUserNotFound) {
+		context.JSON(http.StatusNotFound, models.ApiResult{
+			StatusCode: http.StatusNotFound,
+			Error:      err.Error(),
+		})
+		return false
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return false
+	}
+
+	return true
+}
+
+// exportZip bundles the export as one JSON file per section
+func exportZip(export models.PersonalDataExport) ([]byte, error) {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"identities.json", export.Identities},
+		{"donations.json", export.Donations},
+		{"donation_requests.json", export.DonationRequests},
+		{"sessions.json", export.Sessions},
+		{"api_tokens.json", export.ApiTokens},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// userIDParam parses the :id route parameter, writing a 400 response if it is invalid
+func userIDParam(context *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(context.Param("id"), 10, 32)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      "invalid user id",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
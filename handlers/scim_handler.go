@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"lunchorder/models"
+	"lunchorder/service"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const scimContentType = "application/scim+json"
+
+// scimDefaultCount is the page size when the client does not ask for one
+const scimDefaultCount = 100
+
+type ScimHandler struct {
+	scimService *service.ScimService
+}
+
+func NewScimHandler(scimService *service.ScimService) *ScimHandler {
+	return &ScimHandler{scimService: scimService}
+}
+
+// ScimAuthMiddleware admits requests carrying the SCIM bearer token that the
+// identity provider was configured with
+func ScimAuthMiddleware(token string) gin.HandlerFunc {
+	expected := sha256.Sum256([]byte(token))
+
+	return func(c *gin.Context) {
+		bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		presented := sha256.Sum256([]byte(strings.TrimSpace(bearer)))
+		if !ok || subtle.ConstantTimeCompare(expected[:], presented[:]) != 1 {
+			scimError(c, http.StatusUnauthorized, "", "invalid bearer token")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func (h *ScimHandler) HandleCreateUser(context *gin.Context) {
+	var request models.ScimUser
+	if err := context.ShouldBindJSON(&request); err != nil {
+		scimError(context, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	user, err := h.scimService.CreateUser(&request)
+	if errors.Is(err, service.ErrScimInvalidUserName) {
+		scimError(context, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	if errors.Is(err, service.ErrScimUserExists) {
+		scimError(context, http.StatusConflict, "uniqueness", err.Error())
+		return
+	}
+
+	if err != nil {
+		scimError(context, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	context.Header("Location", user.Meta.Location)
+	scimJSON(context, http.StatusCreated, user)
+}
+
+func (h *ScimHandler) HandleGetUsers(context *gin.Context) {
+	startIndex, err := strconv.Atoi(context.DefaultQuery("startIndex", "1"))
+	if err != nil {
+		scimError(context, http.StatusBadRequest, "invalidValue", "startIndex must be a number")
+		return
+	}
+
+	count, err := strconv.Atoi(context.DefaultQuery("count", strconv.Itoa(scimDefaultCount)))
+	if err != nil {
+		scimError(context, http.StatusBadRequest, "invalidValue", "count must be a number")
+		return
+	}
+
+	users, err := h.scimService.ListUsers(context.Query("filter"), startIndex, count)
+	if errors.Is(err, service.ErrScimInvalidFilter) {
+		scimError(context, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	if err != nil {
+		scimError(context, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	scimJSON(context, http.StatusOK, users)
+}
+
+func (h *ScimHandler) HandleGetUser(context *gin.Context) {
+	id, ok := scimUserID(context)
+	if !ok {
+		return
+	}
+
+	user, err := h.scimService.GetUser(id)
+	if !scimUserFound(context, err) {
+		return
+	}
+
+	scimJSON(context, http.StatusOK, user)
+}
+
+func (h *ScimHandler) HandlePatchUser(context *gin.Context) {
+	id, ok := scimUserID(context)
+	if !ok {
+		return
+	}
+
+	var patch models.ScimPatchRequest
+	if err := context.ShouldBindJSON(&patch); err != nil {
+		scimError(context, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	user, err := h.scimService.PatchUser(id, &patch)
+	if errors.Is(err, service.ErrScimInvalidPatch) {
+		scimError(context, http.StatusBadRequest, "mutability", err.Error())
+		return
+	}
+
+	if !scimUserFound(context, err) {
+		return
+	}
+
+	scimJSON(context, http.StatusOK, user)
+}
+
+func (h *ScimHandler) HandleDeleteUser(context *gin.Context) {
+	id, ok := scimUserID(context)
+	if !ok {
+		return
+	}
+
+	err := h.scimService.DeleteUser(id)
+	if !scimUserFound(context, err) {
+		return
+	}
+
+	context.Status(http.StatusNoContent)
+}
+
+// scimUserFound writes the error response for err, if there is one
+func scimUserFound(context *gin.Context, err error) bool {
+	if errors.Is(err, service.ErrUserNotFound) {
+		scimError(context, http.StatusNotFound, "", err.Error())
+		return false
+	}
+
+	if err != nil {
+		scimError(context, http.StatusInternalServerError, "", err.Error())
+		return false
+	}
+
+	return true
+}
+
+func scimUserID(context *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(context.Param("id"), 10, 32)
+	if err != nil {
+		scimError(context, http.StatusNotFound, "", service.ErrUserNotFound.Error())
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func scimJSON(context *gin.Context, status int, body any) {
+	context.Header("Content-Type", scimContentType)
+	context.JSON(status, body)
+}
+
+func scimError(context *gin.Context, status int, scimType string, detail string) {
+	scimJSON(context, status, models.ScimError{
+		Schemas:  []string{models.ScimErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
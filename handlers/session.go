@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"lunchorder/auth"
+	"lunchorder/repository"
+	"lunchorder/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// sessionIssuer opens sessions and keeps the access and refresh token cookies up to date
+type sessionIssuer struct {
+	userRepo       *repository.UserRepository
+	sessionService *service.SessionService
+	keyring        *auth.Keyring
+	cookies        CookieSettings
+}
+
+func newSessionIssuer(userRepo *repository.UserRepository, sessionService *service.SessionService, keyring *auth.Keyring, cookies CookieSettings) *sessionIssuer {
+	return &sessionIssuer{
+		userRepo:       userRepo,
+		sessionService: sessionService,
+		keyring:        keyring,
+		cookies:        cookies,
+	}
+}
+
+// start opens a server-side session for user and sets the access and refresh
+// token cookies. Deactivated users get service.ErrUserDeactivated instead.
+func (s *sessionIssuer) start(c *gin.Context, user *repository.User) error {
+	// user may have been built from the login provider's profile, so check the stored flag
+	stored, err := s.userRepo.GetUserByID(user.ID)
+	if err != nil {
+		return err
+	}
+	if !stored.Active {
+		return service.ErrUserDeactivated
+	}
+
+	sessionID, refreshToken, err := s.sessionService.CreateSession(user.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.setCookies(c, user, sessionID, refreshToken)
+}
+
+// refresh trades the refresh token cookie for a new session cookie pair
+func (s *sessionIssuer) refresh(c *gin.Context) (*repository.User, string, error) {
+	refreshToken, _ := c.Cookie("refresh_token")
+
+	session, newRefreshToken, err := s.sessionService.RefreshSession(c.Request.Context(), refreshToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	user, err := s.userRepo.GetUserByID(session.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !user.Active || user.DeletedAt != nil {
+		return nil, "", service.ErrUserDeactivated
+	}
+
+	if err := s.setCookies(c, user, session.ID, newRefreshToken); err != nil {
+		return nil, "", err
+	}
+
+	return user, session.ID, nil
+}
+
+func (s *sessionIssuer) setCookies(c *gin.Context, user *repository.User, sessionID string, refreshToken string) error {
+	jwtToken, err := s.generateJWT(user, sessionID)
+	if err != nil {
+		return err
+	}
+
+	// The cookie outlives the token so an expired access token can still be traded in via the refresh token
+	s.cookies.set(c, "auth_token", jwtToken, int(service.RefreshTokenTTL.Seconds()))
+	if refreshToken != "" {
+		s.cookies.set(c, "refresh_token", refreshToken, int(service.RefreshTokenTTL.Seconds()))
+	}
+	return nil
+}
+
+func (s *sessionIssuer) generateJWT(user *repository.User, sessionID string) (string, error) {
+	claims := jwt.MapClaims{
+		"id":    user.ID,
+		"jti":   sessionID,
+		"email": user.Email,
+		"name":  user.Name,
+		"exp":   time.Now().Add(service.AccessTokenTTL).Unix(),
+	}
+	return s.keyring.Sign(claims)
+}
+
+// impersonate replaces the access token cookie with a token for the user an
+// admin is impersonating, marked as such and carrying the admin's id. The
+// refresh token cookie still belongs to the admin's session, which takes over
+// again once the impersonation token expires or is ended.
+func (s *sessionIssuer) impersonate(c *gin.Context, user *repository.User, impersonation *repository.Impersonation) error {
+	claims := jwt.MapClaims{
+		"id":              user.ID,
+		"jti":             impersonation.ID,
+		"name":            user.Name,
+		"impersonation":   true,
+		"impersonator_id": impersonation.AdminUserID,
+		"exp":             time.Now().Add(service.ImpersonationTTL).Unix(),
+	}
+	jwtToken, err := s.keyring.Sign(claims)
+	if err != nil {
+		return err
+	}
+
+	s.cookies.set(c, "auth_token", jwtToken, int(service.RefreshTokenTTL.Seconds()))
+	return nil
+}
+
+func (s *sessionIssuer) clearCookies(c *gin.Context) {
+	s.cookies.clear(c, "auth_token")
+	s.cookies.clear(c, "refresh_token")
+}
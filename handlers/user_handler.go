@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"errors"
+	"lunchorder/models"
+	"lunchorder/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UserHandler struct {
+	userService *service.UserService
+}
+
+func NewUserHandler(userService *service.UserService) *UserHandler {
+	return &UserHandler{userService: userService}
+}
+
+// HandleGetMe returns the signed-in user's profile and preferences, and who
+// is impersonating them if an admin is. Unlike the other routes the profile is
+// not wrapped in an ApiResult.
+func (h *UserHandler) HandleGetMe(context *gin.Context) {
+	user, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	profile, err := h.userService.GetProfile(user.ID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if impersonation, impersonator, ok := currentImpersonation(context); ok {
+		response := service.ToImpersonationResponse(impersonation, impersonator)
+		profile.Impersonation = &response
+	}
+
+	context.JSON(http.StatusOK, profile)
+}
+
+func (h *UserHandler) HandleUpdateMe(context *gin.Context) {
+	user, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      "unauthorized",
+		})
+		return
+	}
+
+	var update models.UserProfileUpdate
+	if err := context.BindJSON(&update); err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	profile, err := h.userService.UpdateProfile(user.ID, &update)
+	if errors.Is(err, service.ErrInvalidDisplayName) ||
+		errors.Is(err, service.ErrInvalidNotificationChannel) ||
+		errors.Is(err, service.ErrInvalidDietaryProfile) ||
+		errors.Is(err, service.ErrInvalidPickupLocation) ||
+		errors.Is(err, service.ErrInvalidTimezone) {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+		Data:       profile,
+	})
+}
+
+func (h *UserHandler) HandleGetUsers(context *gin.Context) {
+	users, err := h.userService.GetUsers()
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+		Data:       users,
+	})
+}
+
+func (h *UserHandler) HandleSetUserActive(context *gin.Context) {
+	admin, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      "unauthorized",
+		})
+		return
+	}
+
+	id, ok := userIDParam(context)
+	if !ok {
+		return
+	}
+
+	var request models.UserActiveRequest
+	if err := context.BindJSON(&request); err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	err := h.userService.SetUserActive(id, request.Active, admin.ID)
+	if errors.Is(err, service.ErrDeactivateSelf) {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrUserNotFound) {
+		context.JSON(http.StatusNotFound, models.ApiResult{
+			StatusCode: http.StatusNotFound,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+	})
+}
+
+func (h *UserHandler) HandleMergeUsers(context *gin.Context) {
+	admin, ok := currentUser(context)
+	if !ok {
+		context.JSON(http.StatusUnauthorized, models.ApiResult{
+			StatusCode: http.StatusUnauthorized,
+			Error:      "unauthorized",
+		})
+		return
+	}
+
+	var mergeRequest models.UserMergeRequest
+	err := context.BindJSON(&mergeRequest)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	merge, err := h.userService.MergeUsers(&mergeRequest, admin.ID)
+
+	if errors.Is(err, service.ErrMergeSameUser) {
+		context.JSON(http.StatusBadRequest, models.ApiResult{
+			StatusCode: http.StatusBadRequest,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrUserNotFound) {
+		context.JSON(http.StatusNotFound, models.ApiResult{
+			StatusCode: http.StatusNotFound,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+		Data:       merge,
+	})
+}
+
+func (h *UserHandler) HandleGetUserMerges(context *gin.Context) {
+	merges, err := h.userService.GetUserMerges()
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, models.ApiResult{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err.Error(),
+		})
+		return
+	}
+
+	context.JSON(http.StatusOK, models.ApiResult{
+		StatusCode: http.StatusOK,
+		Data:       merges,
+	})
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"lunchorder/config"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// personalKeys are attributes that hold personal data, which is encrypted at
+// rest and must not end up in the logs in plain text either
+var personalKeys = map[string]bool{
+	"email":         true,
+	"name":          true,
+	"first_name":    true,
+	"last_name":     true,
+	"avatar_url":    true,
+	"google_id":     true,
+	"subject":       true,
+	"token":         true,
+	"refresh_token": true,
+	"password":      true,
+	"authorization": true,
+	"cookie":        true,
+}
+
+// emailPattern catches addresses inside messages and errors, such as a
+// duplicate key error quoting the value
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+type requestIDKey struct{}
+
+// Setup makes a logger writing to w in the configured format and level the
+// default, which also routes the standard log package through it
+func Setup(w io.Writer, config config.LogConfig) *slog.Logger {
+	options := &slog.HandlerOptions{
+		Level:       config.Level,
+		ReplaceAttr: redact,
+	}
+
+	var handler slog.Handler
+	if config.Format == "text" {
+		handler = slog.NewTextHandler(w, options)
+	} else {
+		handler = slog.NewJSONHandler(w, options)
+	}
+
+	logger := slog.New(&contextHandler{Handler: handler})
+	slog.SetDefault(logger)
+	return logger
+}
+
+// WithRequestID returns a context whose log records carry the request id
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the id of the request ctx belongs to, or "" outside a request
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// contextHandler adds the request id to every record logged with a request's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// redact runs on every attribute, including the message
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if personalKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, redacted)
+	}
+
+	switch value := attr.Value.Any().(type) {
+	case string:
+		return slog.String(attr.Key, maskEmails(value))
+	case error:
+		return slog.String(attr.Key, maskEmails(value.Error()))
+	}
+	return attr
+}
+
+func maskEmails(text string) string {
+	return emailPattern.ReplaceAllString(text, redacted)
+}
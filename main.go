@@ -1,123 +1,289 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/mysql"
+	"github.com/golang-migrate/migrate/v4/source"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jmoiron/sqlx"
-	"github.com/joho/godotenv"
-	"log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"io/fs"
+	"log/slog"
+	"lunchorder/auth"
+	"lunchorder/config"
 	"lunchorder/handlers"
+	"lunchorder/logging"
+	"lunchorder/metrics"
 	"lunchorder/repository"
 	"lunchorder/router"
 	"lunchorder/service"
+	"lunchorder/utils"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
+// backfillBatchSize is how many rows the startup backfill reads at a time
+const backfillBatchSize = 500
+
 func main() {
-	var err error
+	cfg, err := config.Load()
+	if err != nil {
+		// Printed as is, one problem per line, as logging is not set up yet
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logging.Setup(os.Stdout, cfg.Log)
+	gin.SetMode(cfg.GinMode)
 
-	err = loadEnvironmentVariables(err)
+	if cfg.DevLogin {
+		slog.Warn("Dev login is enabled, anyone can sign in as any user")
+	}
 
-	db, err := getDBConfig()
+	keyring, err := auth.LoadKeyring(cfg.JWT, cfg.Release())
 	if err != nil {
-		log.Fatal(err)
+		fatal("Invalid JWT key configuration", err)
 	}
-	initDB(db)
+
+	dataKeys, err := utils.LoadDataKeys(cfg.Encryption)
+	if err != nil {
+		fatal("Invalid data key configuration", err)
+	}
+
+	keyProvider, err := utils.LoadKeyProvider(cfg.Encryption, dataKeys)
+	if err != nil {
+		fatal("Invalid key provider configuration", err)
+	}
+
+	cookies := handlers.NewCookieSettings(cfg.Cookies)
+
+	db, err := repository.Connect(cfg.Database)
+	if err != nil {
+		fatal("Failed to connect to the database", err)
+	}
+	metrics.RegisterDB(db.DB)
+	migrationVersion := initDB(db)
 
 	// Repositories
 	mealRepository := repository.NewMealRepository(db)
-	userRepository := repository.NewUserRepository(db)
+	userKeyRepository := repository.NewUserKeyRepository(db, dataKeys, keyProvider)
+	userRepository := repository.NewUserRepository(db, userKeyRepository)
 	donationRepository := repository.NewDonationRepository(db, userRepository)
 	donationRequestRepository := repository.NewDonationRequestRepository(db, userRepository, donationRepository)
+	emailAccessRepository := repository.NewEmailAccessRepository(db, dataKeys)
+	sessionRepository := repository.NewSessionRepository(db)
+	apiTokenRepository := repository.NewApiTokenRepository(db)
+	userMergeRepository := repository.NewUserMergeRepository(db, userRepository, userKeyRepository)
+	auditRepository := repository.NewAuditRepository(db)
+	impersonationRepository := repository.NewImpersonationRepository(db)
+	healthRepository := repository.NewHealthRepository(db)
+	go backfillPlaintext(repository.NewKeyRotationRepository(db, userKeyRepository))
 
 	// Services
 	donationService := service.NewDonationService(donationRepository, mealRepository, userRepository)
 	mealService := service.NewMealService(mealRepository)
 	donationRequestService := service.NewDonationRequestService(donationRequestRepository, donationRepository, userRepository)
+	emailAccessService := service.NewEmailAccessService(emailAccessRepository, cfg.AllowedEmailDomains)
+	auditService := service.NewAuditService(auditRepository)
+	sessionService := service.NewSessionService(sessionRepository, impersonationRepository, auditService)
+	apiTokenService := service.NewApiTokenService(apiTokenRepository)
+	userService := service.NewUserService(userRepository, userMergeRepository, sessionService)
+	privacyService := service.NewPrivacyService(userRepository, donationRepository, donationRequestRepository, sessionRepository, apiTokenRepository, sessionService)
+	impersonationService := service.NewImpersonationService(impersonationRepository, userRepository, sessionService, auditService)
+	scimService := service.NewScimService(userRepository, userService, privacyService)
+	healthService := service.NewHealthService(healthRepository, migrationVersion)
 
 	// Handlers
 	mealHandler := handlers.NewMealHandler(mealService)
-	donationHandler := handlers.NewDonationHandler(donationService, donationRequestService)
+	donationHandler := handlers.NewDonationHandler(donationService, donationRequestService, keyring)
 	donationRequestHandler := handlers.NewDonationRequestHandler(donationRequestService)
-	authHandler := handlers.NewAuthHandler(userRepository)
+	emailAccessHandler := handlers.NewEmailAccessHandler(emailAccessService)
+	apiTokenHandler := handlers.NewApiTokenHandler(apiTokenService)
+	privacyHandler := handlers.NewPrivacyHandler(privacyService, cookies)
+	userHandler := handlers.NewUserHandler(userService)
+	impersonationHandler := handlers.NewImpersonationHandler(impersonationService, userRepository, sessionService, keyring, cookies)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	authHandler := handlers.NewAuthHandler(userRepository, emailAccessService, sessionService, impersonationService, keyring, auth.LoadProviders(context.Background(), cfg.Google, cfg.OIDC), cookies, cfg.DevLogin)
 
 	// Route setup
-	r := gin.Default()
-	router.SetupCors(r)
+	r := gin.New()
+	r.Use(router.RequestIDMiddleware(), router.AccessLogMiddleware(), router.MetricsMiddleware(), gin.Recovery())
+	router.SetupCors(r, cfg.CorsAllowedOrigins)
+	router.SetupCsrf(r, cfg.CorsAllowedOrigins)
 	router.SetupFrontEnd(r)
-	router.SetupRoutes(r, mealHandler, donationHandler, donationRequestHandler, authHandler, userRepository)
+	router.SetupHealthRoutes(r, handlers.NewHealthHandler(healthService))
+	router.SetupRoutes(r, mealHandler, donationHandler, donationRequestHandler, authHandler, emailAccessHandler, apiTokenHandler, privacyHandler, userHandler, impersonationHandler, auditHandler, userRepository, sessionService, apiTokenService, impersonationService, keyring, cookies)
+	if cfg.DevLogin {
+		router.SetupDevRoutes(r, handlers.NewDevAuthHandler(userRepository, sessionService, keyring, cookies))
+	}
+	if cfg.ScimToken != "" {
+		router.SetupScimRoutes(r, handlers.NewScimHandler(scimService), cfg.ScimToken)
+	}
 
 	// Start server
-	err = r.Run(":8080")
-	if err != nil {
-		log.Fatal(err)
+	servers := []*http.Server{newServer(cfg.Server, cfg.Server.Port, r)}
+	if cfg.Server.MetricsPort != 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		servers = append(servers, newServer(cfg.Server, cfg.Server.MetricsPort, mux))
+	}
+	serve(servers, healthService, cfg.Server.ShutdownDelay, cfg.Server.ShutdownTimeout)
+
+	if err := db.Close(); err != nil {
+		slog.Error("Failed to close database", "error", err)
 	}
+	slog.Info("Server stopped")
 }
 
-func loadEnvironmentVariables(err error) error {
-	err = godotenv.Load()
-	if err != nil {
-		log.Println("Error loading .env file, reading from environment")
+func newServer(config config.ServerConfig, port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         fmt.Sprintf(":%d", port),
+		Handler:      handler,
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
 	}
-	return err
 }
 
-func getDBConfig() (*sqlx.DB, error) {
-	user, foundUser := os.LookupEnv("MYSQL_USER")
-	password, foundPassword := os.LookupEnv("MYSQL_PASSWORD")
-	host, foundHost := os.LookupEnv("MYSQL_HOST")
-	port, foundPort := os.LookupEnv("MYSQL_PORT")
-	database, foundDatabase := os.LookupEnv("MYSQL_DATABASE")
+// serve runs the servers until SIGTERM or SIGINT. It then fails readiness for
+// shutdownDelay, so load balancers stop sending traffic, before it stops
+// accepting connections and gives in-flight requests shutdownTimeout to finish.
+func serve(servers []*http.Server, healthService *service.HealthService, shutdownDelay time.Duration, shutdownTimeout time.Duration) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	if !foundUser || !foundPassword || !foundHost || !foundPort || !foundDatabase {
-		return nil, fmt.Errorf("missing required environment variables")
+	serverErr := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() {
+			serverErr <- server.ListenAndServe()
+		}()
+		slog.Info("Listening", "address", server.Addr)
 	}
 
-	// Add connection parameters for reliability and timeouts
-	finalString := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&multiStatements=true&timeout=10s&readTimeout=30s&writeTimeout=30s&charset=utf8mb4&collation=utf8mb4_unicode_ci",
-		user, password, host, port, database)
-
-	db, err := sqlx.Connect("mysql", finalString)
-	if err != nil {
-		return nil, err
+	select {
+	case err := <-serverErr:
+		fatal("Server failed", err)
+	case <-ctx.Done():
 	}
+	// A second signal kills the process straight away
+	stop()
+
+	slog.Info("Shutting down, failing readiness", "delay", shutdownDelay.String())
+	healthService.StartShutdown()
+	time.Sleep(shutdownDelay)
 
-	// Configure connection pool to prevent connection exhaustion and timeouts
-	db.SetMaxOpenConns(25)                  // Maximum number of open connections to the database
-	db.SetMaxIdleConns(5)                   // Maximum number of idle connections in the pool
-	db.SetConnMaxLifetime(5 * time.Minute)  // Maximum lifetime of a connection (prevents stale connections)
-	db.SetConnMaxIdleTime(1 * time.Minute)  // Maximum time a connection can be idle
+	slog.Info("Draining in-flight requests")
 
-	return db, nil
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("Requests still running were cut off", "address", server.Addr, "timeout", shutdownTimeout.String(), "error", err)
+		}
+	}
 }
 
-func initDB(db *sqlx.DB) {
+// initDB applies the migrations and returns the latest version embedded in
+// this build, which the database must be at to be ready
+func initDB(db *sqlx.DB) uint {
 	driver, err := mysql.WithInstance(db.DB, &mysql.Config{})
 	if err != nil {
-		log.Fatal("Failed to create migration driver: ", err)
+		fatal("Failed to create migration driver", err)
 	}
 
 	d, err := iofs.New(migrationsFS, "migrations")
 	if err != nil {
-		log.Fatal("Failed to create migration source: ", err)
+		fatal("Failed to create migration source", err)
+	}
+
+	expected, err := latestMigration(d)
+	if err != nil {
+		fatal("Failed to read migration source", err)
 	}
 
 	m, err := migrate.NewWithInstance("iofs", d, "mysql", driver)
 	if err != nil {
-		log.Fatal("Failed to create migration instance: ", err)
+		fatal("Failed to create migration instance", err)
 	}
 
 	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		log.Fatal("Failed to run migrations: ", err)
+		fatal("Failed to run migrations", err)
+	}
+
+	version, _, err := m.Version()
+	if err != nil {
+		fatal("Failed to read migration version", err)
+	}
+	slog.Info("Migrations ran successfully", "version", version, "expected", expected)
+	return expected
+}
+
+// latestMigration returns the highest version in the migration source
+func latestMigration(source source.Driver) (uint, error) {
+	version, err := source.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := source.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// backfillPlaintext encrypts the values migrations left in legacy plaintext
+// columns, such as the user profile columns of migration 000012. It runs in
+// the background while the server starts: RotateBatch is safe to run against
+// live traffic and from several instances at once. Tables without plaintext
+// left are only checked, so once done this costs one query per table.
+func backfillPlaintext(rotation *repository.KeyRotationRepository) {
+	for _, table := range repository.EncryptedTables {
+		remaining, err := rotation.HasPlaintext(table)
+		if err != nil {
+			slog.Warn("Failed to check for plaintext left to encrypt", "table", table.Name, "error", err)
+			continue
+		}
+		if !remaining {
+			continue
+		}
+
+		slog.Info("Encrypting plaintext left by migrations", "table", table.Name)
+		var lastID uint
+		rotated := 0
+		for {
+			batch, err := rotation.RotateBatch(table, lastID, backfillBatchSize)
+			if err != nil {
+				slog.Warn("Plaintext backfill stopped, finish it with crypto_tool -action=rotate",
+					"table", table.Name, "after_id", lastID, "error", err)
+				break
+			}
+			rotated += batch.Rotated
+			lastID = batch.LastID
+			if batch.Scanned < backfillBatchSize {
+				slog.Info("Plaintext backfill done", "table", table.Name, "rotated", rotated)
+				break
+			}
+		}
 	}
-	log.Println("Migrations ran successfully")
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
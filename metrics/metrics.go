@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "lunchorder"
+
+// Ways a donation gets claimed, for the via label of DonationsClaimed
+const (
+	ClaimedDirectly  = "claim"
+	ClaimedByRequest = "request"
+)
+
+// HTTPRequestDuration is labelled with the route pattern rather than the path,
+// so ids in paths do not create a series per user
+var HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "http_request_duration_seconds",
+	Help:      "Time taken to answer HTTP requests, by method, route and status.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "route", "status"})
+
+var DonationsCreated = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "donations_created_total",
+	Help:      "Meals offered for donation.",
+})
+
+var DonationsClaimed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "donations_claimed_total",
+	Help:      "Donations claimed, directly or by fulfilling a donation request.",
+}, []string{"via"})
+
+var DonationRequestsCreated = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "donation_requests_created_total",
+	Help:      "Donation requests made.",
+})
+
+var DonationRequestsFulfilled = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "donation_requests_fulfilled_total",
+	Help:      "Donation requests matched with a donation.",
+})
+
+var MatcherDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "matcher_duration_seconds",
+	Help:      "Time taken by a run of the matcher that fulfils pending donation requests.",
+	Buckets:   prometheus.DefBuckets,
+})
+
+// RegisterDB exports the connection pool statistics of db
+func RegisterDB(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
@@ -0,0 +1 @@
+ALTER TABLE donations DROP COLUMN collected_at;
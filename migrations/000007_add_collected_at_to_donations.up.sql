@@ -0,0 +1 @@
+ALTER TABLE donations ADD COLUMN collected_at DATETIME NULL;
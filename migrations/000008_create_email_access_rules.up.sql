@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS email_access_rules (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    email_hash VARCHAR(64) UNIQUE NOT NULL,
+    email_encrypted TEXT NOT NULL,
+    rule VARCHAR(10) NOT NULL
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci;
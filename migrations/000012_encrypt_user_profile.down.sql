@@ -0,0 +1,5 @@
+-- WARNING: Values already moved to the encrypted columns by the backfill are lost.
+ALTER TABLE users
+DROP COLUMN first_name_encrypted,
+DROP COLUMN last_name_encrypted,
+DROP COLUMN avatar_url_encrypted;
@@ -0,0 +1,8 @@
+ALTER TABLE users
+ADD COLUMN first_name_encrypted TEXT,
+ADD COLUMN last_name_encrypted TEXT,
+ADD COLUMN avatar_url_encrypted TEXT;
+
+-- The plaintext first_name, last_name and avatar_url columns are cleared by
+-- the backfill (go run tools/crypto_tool.go -action=rotate) rather than here,
+-- as encrypting needs the application key.
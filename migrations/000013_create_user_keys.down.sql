@@ -0,0 +1,2 @@
+-- WARNING: Values encrypted with a user's key become unreadable.
+DROP TABLE IF EXISTS user_keys;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS user_keys (
+    user_id INT UNSIGNED PRIMARY KEY,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    wrapped_key TEXT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS user_merges (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    source_user_id INT UNSIGNED NOT NULL,
+    target_user_id INT UNSIGNED NOT NULL,
+    merged_by_user_id INT UNSIGNED NOT NULL,
+    donations_moved INT UNSIGNED NOT NULL,
+    received_moved INT UNSIGNED NOT NULL,
+    requests_moved INT UNSIGNED NOT NULL,
+    identities_moved INT UNSIGNED NOT NULL,
+    FOREIGN KEY (source_user_id) REFERENCES users(id),
+    FOREIGN KEY (target_user_id) REFERENCES users(id),
+    FOREIGN KEY (merged_by_user_id) REFERENCES users(id)
+) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci;
@@ -0,0 +1,4 @@
+ALTER TABLE users
+ADD UNIQUE INDEX name (name),
+DROP INDEX idx_users_handle,
+DROP COLUMN handle;
@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN handle VARCHAR(64) NULL;
+
+-- Existing users get a handle derived from their name. Names that reduce to
+-- the same handle get their id appended; "_" never occurs in a derived handle.
+UPDATE users u
+JOIN (
+    SELECT id, slug, COUNT(*) OVER (PARTITION BY slug) AS taken
+    FROM (
+        SELECT id, LEFT(LOWER(TRIM(BOTH '-' FROM REGEXP_REPLACE(name, '[^A-Za-z0-9]+', '-'))), 48) AS slug
+        FROM users
+    ) slugs
+) handles ON u.id = handles.id
+SET u.handle = IF(handles.taken = 1 AND handles.slug <> '', handles.slug, CONCAT(IF(handles.slug = '', 'user', handles.slug), '_', u.id));
+
+ALTER TABLE users
+MODIFY handle VARCHAR(64) NOT NULL,
+ADD UNIQUE INDEX idx_users_handle (handle),
+DROP INDEX name;
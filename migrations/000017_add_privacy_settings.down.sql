@@ -0,0 +1,3 @@
+ALTER TABLE donations DROP COLUMN anonymous;
+
+ALTER TABLE users DROP COLUMN name_visibility;
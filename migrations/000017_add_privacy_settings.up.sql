@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN name_visibility VARCHAR(10) NOT NULL DEFAULT 'everyone';
+
+ALTER TABLE donations ADD COLUMN anonymous BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,6 @@
+ALTER TABLE users
+DROP COLUMN name_is_custom,
+DROP COLUMN notification_channels,
+DROP COLUMN dietary_profile_encrypted,
+DROP COLUMN pickup_location,
+DROP COLUMN timezone;
@@ -0,0 +1,6 @@
+ALTER TABLE users
+ADD COLUMN name_is_custom BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN notification_channels VARCHAR(64) NOT NULL DEFAULT 'email',
+ADD COLUMN dietary_profile_encrypted TEXT,
+ADD COLUMN pickup_location VARCHAR(100),
+ADD COLUMN timezone VARCHAR(64);
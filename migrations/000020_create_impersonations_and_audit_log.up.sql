@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    actor_user_id INT UNSIGNED NOT NULL,
+    subject_user_id INT UNSIGNED NULL,
+    action VARCHAR(64) NOT NULL,
+    detail TEXT NULL,
+    FOREIGN KEY (actor_user_id) REFERENCES users(id),
+    FOREIGN KEY (subject_user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+
+CREATE TABLE IF NOT EXISTS impersonations (
+    id VARCHAR(64) PRIMARY KEY,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    admin_user_id INT UNSIGNED NOT NULL,
+    admin_session_id VARCHAR(64) NOT NULL,
+    user_id INT UNSIGNED NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    allow_writes BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at DATETIME NOT NULL,
+    ended_at DATETIME NULL,
+    FOREIGN KEY (admin_user_id) REFERENCES users(id),
+    FOREIGN KEY (admin_session_id) REFERENCES sessions(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
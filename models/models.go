@@ -1,13 +1,20 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type DonationRequest struct {
-	MealID    uint   `json:"mealId"`
-	DonorName string `json:"donorName"`
+	MealID  uint `json:"mealId"`
+	DonorID uint `json:"donorId"`
+	// Anonymous hides the donor's name from everyone, admins included
+	Anonymous bool `json:"anonymous"`
 }
 
 type RecipientRequest struct {
-	DonationID uint   `json:"donationId"`
-	Name       string `json:"name"`
+	DonationID uint `json:"donationId"`
+	UserID     uint `json:"userId"`
 }
 
 type UnclaimedDonationResponse struct {
@@ -44,8 +51,8 @@ type MealUploadRequest struct {
 }
 
 type DonationRequestCreate struct {
-	RequesterName string `json:"requesterName"`
-	MealIds       []uint `json:"mealIds"`
+	RequesterID uint   `json:"requesterId"`
+	MealIds     []uint `json:"mealIds"`
 }
 
 type DonationRequestResponse struct {
@@ -54,3 +61,283 @@ type DonationRequestResponse struct {
 	Description   string `json:"description"`
 	Status        string `json:"status"`
 }
+
+type DonationCollectRequest struct {
+	Token string `json:"token"`
+}
+
+type DonationCollectResponse struct {
+	ID            uint   `json:"id"`
+	Description   string `json:"description"`
+	DonorName     string `json:"donorName"`
+	RecipientName string `json:"recipientName"`
+}
+
+type EmailAccessRuleRequest struct {
+	Email string `json:"email"`
+	Rule  string `json:"rule"`
+}
+
+type EmailAccessRuleResponse struct {
+	ID    uint   `json:"id"`
+	Email string `json:"email"`
+	Rule  string `json:"rule"`
+}
+
+type SessionResponse struct {
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	Current    bool       `json:"current"`
+}
+
+type ApiTokenCreateRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"`
+}
+
+type ApiTokenCreatedResponse struct {
+	ID     uint     `json:"id"`
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"`
+}
+
+type ApiTokenResponse struct {
+	ID          uint       `json:"id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"tokenPrefix"`
+	Scopes      []string   `json:"scopes"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt"`
+}
+
+// PersonalDataExport is everything stored about a user, for GET /Api/Me/Export
+type PersonalDataExport struct {
+	ExportedAt       time.Time                     `json:"exportedAt"`
+	Profile          PersonalDataProfile           `json:"profile"`
+	Identities       []PersonalDataIdentity        `json:"identities"`
+	Donations        []PersonalDataDonation        `json:"donations"`
+	DonationRequests []PersonalDataDonationRequest `json:"donationRequests"`
+	Sessions         []PersonalDataSession         `json:"sessions"`
+	ApiTokens        []PersonalDataApiToken        `json:"apiTokens"`
+}
+
+type PersonalDataProfile struct {
+	ID          uint            `json:"id"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	Name        string          `json:"name"`
+	Email       *string         `json:"email"`
+	GoogleID    *string         `json:"googleId"`
+	FirstName   *string         `json:"firstName"`
+	LastName    *string         `json:"lastName"`
+	AvatarURL   *string         `json:"avatarUrl"`
+	IsAdmin     bool            `json:"isAdmin"`
+	Privacy     PrivacySettings `json:"privacy"`
+	Preferences UserPreferences `json:"preferences"`
+}
+
+type PersonalDataIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type PersonalDataDonation struct {
+	ID            uint       `json:"id"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	Role          string     `json:"role"` // "donor", "recipient"
+	Anonymous     bool       `json:"anonymous"`
+	Description   string     `json:"description"`
+	Date          string     `json:"date"`
+	DonorName     string     `json:"donorName"`
+	RecipientName string     `json:"recipientName"`
+	CollectedAt   *time.Time `json:"collectedAt"`
+}
+
+type PersonalDataDonationRequest struct {
+	ID         uint           `json:"id"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	Status     string         `json:"status"`
+	DonationID *uint          `json:"donationId"`
+	Meals      []MealResponse `json:"meals"`
+}
+
+type PersonalDataSession struct {
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+type PersonalDataApiToken struct {
+	ID          uint       `json:"id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"tokenPrefix"`
+	Scopes      []string   `json:"scopes"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt"`
+	RevokedAt   *time.Time `json:"revokedAt"`
+}
+
+type UserMergeRequest struct {
+	SourceUserID uint `json:"sourceUserId"`
+	TargetUserID uint `json:"targetUserId"`
+}
+
+// AdminUserResponse is a user as listed in admin user management
+type AdminUserResponse struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Handle    string    `json:"handle"`
+	Name      string    `json:"name"`
+	Email     *string   `json:"email"`
+	IsAdmin   bool      `json:"isAdmin"`
+	Active    bool      `json:"active"`
+}
+
+type UserActiveRequest struct {
+	Active bool `json:"active"`
+}
+
+type UserMergeResponse struct {
+	ID              uint      `json:"id"`
+	CreatedAt       time.Time `json:"createdAt"`
+	SourceUserID    uint      `json:"sourceUserId"`
+	TargetUserID    uint      `json:"targetUserId"`
+	MergedByUserID  uint      `json:"mergedByUserId"`
+	DonationsMoved  uint      `json:"donationsMoved"`
+	ReceivedMoved   uint      `json:"receivedMoved"`
+	RequestsMoved   uint      `json:"requestsMoved"`
+	IdentitiesMoved uint      `json:"identitiesMoved"`
+}
+
+type PrivacySettings struct {
+	NameVisibility string `json:"nameVisibility"` // "everyone", "admins", "nobody"
+}
+
+// UserProfileResponse is the signed-in user as returned by GET /Api/Me
+type UserProfileResponse struct {
+	ID          uint            `json:"id"`
+	Handle      string          `json:"handle"`
+	Name        string          `json:"name"`
+	Email       *string         `json:"email"`
+	FirstName   *string         `json:"firstName"`
+	LastName    *string         `json:"lastName"`
+	AvatarURL   *string         `json:"avatarUrl"`
+	IsAdmin     bool            `json:"isAdmin"`
+	Preferences UserPreferences `json:"preferences"`
+	// Impersonation is set while an admin is acting as this user
+	Impersonation *ImpersonationResponse `json:"impersonation"`
+}
+
+type UserPreferences struct {
+	NotificationChannels  []string `json:"notificationChannels"` // "email", "push"
+	DietaryProfile        []string `json:"dietaryProfile"`       // e.g. "vegetarian", "gluten_free"
+	DefaultPickupLocation *string  `json:"defaultPickupLocation"`
+	Timezone              *string  `json:"timezone"` // IANA name, e.g. "Europe/Berlin"
+}
+
+// UserProfileUpdate replaces the display name and every preference
+type UserProfileUpdate struct {
+	Name string `json:"name"`
+	UserPreferences
+}
+
+type ImpersonationRequest struct {
+	Reason      string `json:"reason"`
+	AllowWrites bool   `json:"allowWrites"`
+}
+
+type ImpersonationResponse struct {
+	ImpersonatorID   uint      `json:"impersonatorId"`
+	ImpersonatorName string    `json:"impersonatorName"`
+	UserID           uint      `json:"userId"`
+	Reason           string    `json:"reason"`
+	ReadOnly         bool      `json:"readOnly"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+}
+
+type AuditEntryResponse struct {
+	ID            uint      `json:"id"`
+	CreatedAt     time.Time `json:"createdAt"`
+	ActorUserID   uint      `json:"actorUserId"`
+	SubjectUserID *uint     `json:"subjectUserId"`
+	Action        string    `json:"action"`
+	Detail        *string   `json:"detail"`
+}
+
+// SCIM 2.0 (RFC 7643, RFC 7644) resources, see /scim/v2
+
+const (
+	ScimUserSchema       = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimListSchema       = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimPatchOpSchema    = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimErrorSchema      = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ScimUserResourceType = "User"
+)
+
+type ScimUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *ScimName   `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []ScimEmail `json:"emails,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Meta        *ScimMeta   `json:"meta,omitempty"`
+}
+
+type ScimName struct {
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type ScimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type ScimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+type ScimListResponse struct {
+	Schemas      []string   `json:"schemas"`
+	TotalResults int        `json:"totalResults"`
+	StartIndex   int        `json:"startIndex"`
+	ItemsPerPage int        `json:"itemsPerPage"`
+	Resources    []ScimUser `json:"Resources"`
+}
+
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+// ScimPatchOperation changes one attribute. Value is kept raw, as providers
+// differ in how they send it: {"path": "active", "value": false}, the string
+// "False", or {"value": {"active": false}} without a path.
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
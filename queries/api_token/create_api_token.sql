@@ -0,0 +1,2 @@
+INSERT INTO api_tokens (created_at, updated_at, user_id, name, token_prefix, token_hash, scopes, expires_at)
+VALUES (NOW(), NOW(), ?, ?, ?, ?, ?, IF(? > 0, DATE_ADD(NOW(), INTERVAL ? DAY), NULL));
\ No newline at end of file
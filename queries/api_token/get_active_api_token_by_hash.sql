@@ -0,0 +1,4 @@
+SELECT * FROM api_tokens 
+WHERE token_hash = ? 
+AND revoked_at IS NULL 
+AND (expires_at IS NULL OR expires_at > NOW());
\ No newline at end of file
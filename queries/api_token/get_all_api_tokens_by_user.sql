@@ -0,0 +1,3 @@
+SELECT * FROM api_tokens 
+WHERE user_id = ? 
+ORDER BY created_at DESC;
\ No newline at end of file
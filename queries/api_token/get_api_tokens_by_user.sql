@@ -0,0 +1,4 @@
+SELECT * FROM api_tokens 
+WHERE user_id = ? 
+AND revoked_at IS NULL 
+ORDER BY created_at DESC;
\ No newline at end of file
@@ -0,0 +1,3 @@
+UPDATE api_tokens 
+SET revoked_at = NOW(), updated_at = NOW() 
+WHERE user_id = ? AND revoked_at IS NULL;
\ No newline at end of file
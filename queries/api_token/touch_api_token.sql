@@ -0,0 +1,4 @@
+UPDATE api_tokens 
+SET last_used_at = NOW() 
+WHERE id = ? 
+AND (last_used_at IS NULL OR last_used_at < DATE_SUB(NOW(), INTERVAL 1 MINUTE));
\ No newline at end of file
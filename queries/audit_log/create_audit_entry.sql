@@ -0,0 +1,2 @@
+INSERT INTO audit_log (actor_user_id, subject_user_id, action, detail)
+VALUES (?, ?, ?, ?);
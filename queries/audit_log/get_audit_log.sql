@@ -0,0 +1,3 @@
+SELECT * FROM audit_log
+ORDER BY id DESC
+LIMIT ?;
@@ -0,0 +1,5 @@
+DELETE d FROM donations d
+JOIN meals m ON d.meal_id = m.id
+WHERE d.donor_id = ?
+  AND d.recipient_id IS NULL
+  AND m.date >= CURDATE();
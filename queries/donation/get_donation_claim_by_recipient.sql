@@ -5,14 +5,16 @@ SELECT
     d.meal_id, 
     d.donor_id, 
     d.recipient_id,
+    d.anonymous,
     m.id AS "meal.id",
     m.description AS "meal.description",
     m.date AS "meal.date",
     donor.id AS "donor.id",
-    donor.name AS "donor.name"
+    donor.name AS "donor.name",
+    donor.name_visibility AS "donor.name_visibility"
 FROM donations d
 JOIN meals m ON d.meal_id = m.id
 JOIN users donor ON d.donor_id = donor.id
-WHERE d.recipient_id = (SELECT id FROM users WHERE name = ?) 
+WHERE d.recipient_id = ? 
 AND DATE(d.created_at) = DATE(?)
 LIMIT 1;
\ No newline at end of file
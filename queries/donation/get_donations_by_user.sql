@@ -0,0 +1,23 @@
+SELECT 
+    d.id, 
+    d.created_at, 
+    d.updated_at, 
+    d.meal_id, 
+    d.donor_id, 
+    d.recipient_id,
+    d.collected_at,
+    d.anonymous,
+    m.id AS "meal.id",
+    m.description AS "meal.description",
+    m.date AS "meal.date",
+    donor.id AS "donor.id",
+    donor.name AS "donor.name",
+    donor.name_visibility AS "donor.name_visibility",
+    recipient.name AS "recipient.name",
+    recipient.name_visibility AS "recipient.name_visibility"
+FROM donations d
+JOIN meals m ON d.meal_id = m.id
+JOIN users donor ON d.donor_id = donor.id
+LEFT JOIN users recipient ON d.recipient_id = recipient.id
+WHERE d.donor_id = ? OR d.recipient_id = ?
+ORDER BY d.created_at;
\ No newline at end of file
@@ -5,11 +5,13 @@ SELECT
     d.meal_id, 
     d.donor_id, 
     d.recipient_id,
+    d.anonymous,
     m.id AS "meal.id",
     m.description AS "meal.description",
     m.date AS "meal.date",
     u.id AS "donor.id",
-    u.name AS "donor.name"
+    u.name AS "donor.name",
+    u.name_visibility AS "donor.name_visibility"
 FROM donations d
 JOIN meals m ON d.meal_id = m.id
 JOIN users u ON d.donor_id = u.id
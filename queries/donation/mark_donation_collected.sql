@@ -0,0 +1,3 @@
+UPDATE donations 
+SET collected_at = NOW(), updated_at = NOW() 
+WHERE id = ? AND recipient_id = ? AND collected_at IS NULL;
\ No newline at end of file
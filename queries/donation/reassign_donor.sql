@@ -0,0 +1 @@
+UPDATE donations SET donor_id = ?, updated_at = NOW() WHERE donor_id = ?;
\ No newline at end of file
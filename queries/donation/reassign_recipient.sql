@@ -0,0 +1 @@
+UPDATE donations SET recipient_id = ?, updated_at = NOW() WHERE recipient_id = ?;
\ No newline at end of file
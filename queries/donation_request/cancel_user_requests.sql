@@ -0,0 +1,3 @@
+UPDATE donation_requests 
+SET status = 'cancelled', updated_at = NOW() 
+WHERE requester_id = ? AND status = 'pending';
\ No newline at end of file
@@ -0,0 +1,10 @@
+SELECT 
+    dr.id, 
+    dr.created_at, 
+    dr.updated_at, 
+    dr.requester_id, 
+    dr.status, 
+    dr.donation_id
+FROM donation_requests dr
+WHERE dr.requester_id = ?
+ORDER BY dr.created_at;
\ No newline at end of file
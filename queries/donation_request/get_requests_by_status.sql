@@ -6,7 +6,8 @@ SELECT
     dr.status, 
     dr.donation_id,
     u.id AS "requester.id",
-    u.name AS "requester.name"
+    u.name AS "requester.name",
+    u.name_visibility AS "requester.name_visibility"
 FROM donation_requests dr
 JOIN users u ON dr.requester_id = u.id
 WHERE dr.status = ? 
@@ -0,0 +1 @@
+UPDATE donation_requests SET requester_id = ?, updated_at = NOW() WHERE requester_id = ?;
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM email_access_rules WHERE id = ?;
\ No newline at end of file
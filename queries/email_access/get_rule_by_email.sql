@@ -0,0 +1 @@
+SELECT * FROM email_access_rules WHERE email_hash IN (?);
\ No newline at end of file
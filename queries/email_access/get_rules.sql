@@ -0,0 +1 @@
+SELECT * FROM email_access_rules ORDER BY rule, created_at;
\ No newline at end of file
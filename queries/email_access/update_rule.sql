@@ -0,0 +1,6 @@
+UPDATE email_access_rules
+SET email_hash = :email_hash,
+    email_encrypted = :email_encrypted,
+    rule = :rule,
+    updated_at = NOW()
+WHERE id = :id;
\ No newline at end of file
@@ -0,0 +1,5 @@
+INSERT INTO email_access_rules (created_at, updated_at, email_hash, email_encrypted, rule)
+VALUES (NOW(), NOW(), :email_hash, :email_encrypted, :rule)
+ON DUPLICATE KEY UPDATE
+    rule = VALUES(rule),
+    updated_at = NOW();
\ No newline at end of file
@@ -0,0 +1,2 @@
+INSERT INTO impersonations (id, admin_user_id, admin_session_id, user_id, reason, allow_writes, expires_at)
+VALUES (?, ?, ?, ?, ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND));
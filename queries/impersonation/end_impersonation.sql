@@ -0,0 +1,3 @@
+UPDATE impersonations
+SET ended_at = NOW(), updated_at = NOW()
+WHERE id = ? AND ended_at IS NULL;
@@ -0,0 +1,2 @@
+SELECT * FROM impersonations
+WHERE id = ? AND ended_at IS NULL AND expires_at > NOW();
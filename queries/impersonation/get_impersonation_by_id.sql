@@ -0,0 +1 @@
+SELECT * FROM impersonations WHERE id = ?;
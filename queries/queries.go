@@ -16,14 +16,8 @@ var GetMealsByDate string
 var GetMealsByRange string
 
 // User
-//go:embed user/create_user.sql
-var CreateUser string
-
-//go:embed user/get_user_by_name.sql
-var GetUserByName string
-
-//go:embed user/upsert_user_google.sql
-var UpsertUserGoogle string
+//go:embed user/get_user_by_handle.sql
+var GetUserByHandle string
 
 //go:embed user/insert_user_google.sql
 var InsertUserGoogle string
@@ -40,6 +34,49 @@ var GetUserByID string
 //go:embed user/get_user_by_email.sql
 var GetUserByEmail string
 
+//go:embed user/update_user_profile.sql
+var UpdateUserProfile string
+
+//go:embed user/get_users.sql
+var GetUsers string
+
+//go:embed user/get_users_page.sql
+var GetUsersPage string
+
+//go:embed user/count_users.sql
+var CountUsers string
+
+//go:embed user/update_user_admin.sql
+var UpdateUserAdmin string
+
+//go:embed user/update_user_privacy.sql
+var UpdateUserPrivacy string
+
+//go:embed user/update_user_preferences.sql
+var UpdateUserPreferences string
+
+//go:embed user/update_user_active.sql
+var UpdateUserActive string
+
+//go:embed user/anonymise_user.sql
+var AnonymiseUser string
+
+// User Identity
+//go:embed user_identity/create_user_identity.sql
+var CreateUserIdentity string
+
+//go:embed user_identity/get_user_identity_by_subject.sql
+var GetUserIdentityBySubject string
+
+//go:embed user_identity/get_user_identities_by_user.sql
+var GetUserIdentitiesByUser string
+
+//go:embed user_identity/delete_user_identities.sql
+var DeleteUserIdentities string
+
+//go:embed user_identity/reassign_user_identity.sql
+var ReassignUserIdentity string
+
 // Donation
 //go:embed donation/create_donation.sql
 var CreateDonation string
@@ -53,8 +90,26 @@ var GetUnclaimedDonations string
 //go:embed donation/get_donations_summary.sql
 var GetDonationsSummary string
 
-//go:embed donation/get_donation_claim_by_name.sql
-var GetDonationClaimByName string
+//go:embed donation/get_donation_claim_by_recipient.sql
+var GetDonationClaimByRecipient string
+
+//go:embed donation/get_donation_by_id.sql
+var GetDonationByID string
+
+//go:embed donation/mark_donation_collected.sql
+var MarkDonationCollected string
+
+//go:embed donation/get_donations_by_user.sql
+var GetDonationsByUser string
+
+//go:embed donation/reassign_donor.sql
+var ReassignDonor string
+
+//go:embed donation/reassign_recipient.sql
+var ReassignRecipient string
+
+//go:embed donation/delete_unclaimed_donations_by_donor.sql
+var DeleteUnclaimedDonationsByDonor string
 
 // Donation Request
 //go:embed donation_request/create_donation_request.sql
@@ -74,3 +129,128 @@ var GetRequestsByRequester string
 
 //go:embed donation_request/get_request_meals.sql
 var GetRequestMeals string
+
+//go:embed donation_request/get_all_requests_by_requester.sql
+var GetAllRequestsByRequester string
+
+//go:embed donation_request/cancel_user_requests.sql
+var CancelUserRequests string
+
+//go:embed donation_request/reassign_requester.sql
+var ReassignRequester string
+
+// Email Access
+//go:embed email_access/upsert_rule.sql
+var UpsertEmailAccessRule string
+
+//go:embed email_access/get_rule_by_email.sql
+var GetEmailAccessRuleByEmail string
+
+//go:embed email_access/get_rules.sql
+var GetEmailAccessRules string
+
+//go:embed email_access/update_rule.sql
+var UpdateEmailAccessRule string
+
+//go:embed email_access/delete_rule.sql
+var DeleteEmailAccessRule string
+
+// Session
+//go:embed session/create_session.sql
+var CreateSession string
+
+//go:embed session/get_session_by_id.sql
+var GetSessionByID string
+
+//go:embed session/get_session_by_refresh_token.sql
+var GetSessionByRefreshToken string
+
+//go:embed session/get_session_by_previous_refresh_token.sql
+var GetSessionByPreviousRefreshToken string
+
+//go:embed session/rotate_refresh_token.sql
+var RotateRefreshToken string
+
+//go:embed session/revoke_session.sql
+var RevokeSession string
+
+//go:embed session/revoke_user_sessions.sql
+var RevokeUserSessions string
+
+//go:embed session/get_active_user_sessions.sql
+var GetActiveUserSessions string
+
+//go:embed session/get_user_sessions.sql
+var GetUserSessions string
+
+// API Token
+//go:embed api_token/create_api_token.sql
+var CreateApiToken string
+
+//go:embed api_token/get_active_api_token_by_hash.sql
+var GetActiveApiTokenByHash string
+
+//go:embed api_token/get_api_tokens_by_user.sql
+var GetApiTokensByUser string
+
+//go:embed api_token/revoke_api_token.sql
+var RevokeApiToken string
+
+//go:embed api_token/touch_api_token.sql
+var TouchApiToken string
+
+//go:embed api_token/get_all_api_tokens_by_user.sql
+var GetAllApiTokensByUser string
+
+//go:embed api_token/revoke_user_api_tokens.sql
+var RevokeUserApiTokens string
+
+// User Key
+//go:embed user_key/create_user_key.sql
+var CreateUserKey string
+
+//go:embed user_key/get_user_key.sql
+var GetUserKey string
+
+//go:embed user_key/delete_user_key.sql
+var DeleteUserKey string
+
+//go:embed user_key/get_user_keys_after.sql
+var GetUserKeysAfter string
+
+//go:embed user_key/rewrap_user_key.sql
+var RewrapUserKey string
+
+// User Merge
+//go:embed user_merge/create_user_merge.sql
+var CreateUserMerge string
+
+//go:embed user_merge/get_user_merges.sql
+var GetUserMerges string
+
+// Audit Log
+//go:embed audit_log/create_audit_entry.sql
+var CreateAuditEntry string
+
+//go:embed audit_log/get_audit_log.sql
+var GetAuditLog string
+
+// Impersonation
+//go:embed impersonation/create_impersonation.sql
+var CreateImpersonation string
+
+//go:embed impersonation/get_active_impersonation.sql
+var GetActiveImpersonation string
+
+//go:embed impersonation/get_impersonation_by_id.sql
+var GetImpersonationByID string
+
+//go:embed impersonation/end_impersonation.sql
+var EndImpersonation string
+
+//go:embed impersonation/get_active_admin_impersonations.sql
+var GetActiveAdminImpersonations string
+
+// Health
+//go:embed health/get_migration_version.sql
+var GetMigrationVersion string
@@ -0,0 +1,2 @@
+INSERT INTO sessions (id, created_at, updated_at, user_id, refresh_token_hash, expires_at, last_used_at)
+VALUES (?, NOW(), NOW(), ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND), NOW());
\ No newline at end of file
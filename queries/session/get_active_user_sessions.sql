@@ -0,0 +1,5 @@
+SELECT * FROM sessions 
+WHERE user_id = ? 
+AND revoked_at IS NULL 
+AND expires_at > NOW() 
+ORDER BY last_used_at DESC;
\ No newline at end of file
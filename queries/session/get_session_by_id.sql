@@ -0,0 +1 @@
+SELECT * FROM sessions WHERE id = ?;
\ No newline at end of file
@@ -0,0 +1,4 @@
+SELECT * FROM sessions 
+WHERE previous_refresh_token_hash = ? 
+AND revoked_at IS NULL 
+LIMIT 1;
\ No newline at end of file
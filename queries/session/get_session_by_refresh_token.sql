@@ -0,0 +1,6 @@
+SELECT * FROM sessions 
+WHERE (refresh_token_hash = ? 
+    OR (previous_refresh_token_hash = ? AND rotated_at > DATE_SUB(NOW(), INTERVAL 30 SECOND))) 
+AND revoked_at IS NULL 
+AND expires_at > NOW() 
+LIMIT 1;
\ No newline at end of file
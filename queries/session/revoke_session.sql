@@ -0,0 +1,3 @@
+UPDATE sessions 
+SET revoked_at = NOW(), updated_at = NOW() 
+WHERE id = ? AND revoked_at IS NULL;
\ No newline at end of file
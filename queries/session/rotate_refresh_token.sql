@@ -0,0 +1,8 @@
+UPDATE sessions 
+SET previous_refresh_token_hash = refresh_token_hash, 
+    refresh_token_hash = ?, 
+    rotated_at = NOW(), 
+    expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND), 
+    last_used_at = NOW(), 
+    updated_at = NOW() 
+WHERE id = ? AND refresh_token_hash = ? AND revoked_at IS NULL;
\ No newline at end of file
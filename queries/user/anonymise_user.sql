@@ -0,0 +1,22 @@
+UPDATE users
+SET name = ?,
+    handle = CONCAT('deleted:', id),
+    email_hash = NULL,
+    email_encrypted = NULL,
+    google_id_hash = NULL,
+    google_id_encrypted = NULL,
+    first_name = NULL,
+    last_name = NULL,
+    avatar_url = NULL,
+    first_name_encrypted = NULL,
+    last_name_encrypted = NULL,
+    avatar_url_encrypted = NULL,
+    is_admin = FALSE,
+    name_is_custom = FALSE,
+    notification_channels = '',
+    dietary_profile_encrypted = NULL,
+    pickup_location = NULL,
+    timezone = NULL,
+    deleted_at = NOW(),
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND deleted_at IS NULL;
\ No newline at end of file
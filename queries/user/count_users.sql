@@ -0,0 +1 @@
+SELECT COUNT(*) FROM users WHERE deleted_at IS NULL;
\ No newline at end of file
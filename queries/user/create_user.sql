@@ -1,2 +0,0 @@
-INSERT INTO users (created_at, updated_at, name) 
-VALUES (NOW(), NOW(), ?);
\ No newline at end of file
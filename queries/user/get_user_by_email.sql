@@ -1 +1 @@
-SELECT * FROM users WHERE email_hash = ?;
\ No newline at end of file
+SELECT * FROM users WHERE email_hash IN (?);
\ No newline at end of file
@@ -1 +1 @@
-SELECT * FROM users WHERE google_id_hash = ?;
\ No newline at end of file
+SELECT * FROM users WHERE google_id_hash IN (?);
\ No newline at end of file
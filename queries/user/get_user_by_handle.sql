@@ -0,0 +1 @@
+SELECT * FROM users WHERE handle = ?;
\ No newline at end of file
@@ -1,3 +0,0 @@
-SELECT * FROM users 
-WHERE name = ? 
-LIMIT 1;
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT * FROM users ORDER BY name;
\ No newline at end of file
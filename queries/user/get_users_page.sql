@@ -0,0 +1 @@
+SELECT * FROM users WHERE deleted_at IS NULL ORDER BY id LIMIT ? OFFSET ?;
\ No newline at end of file
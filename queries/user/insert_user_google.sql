@@ -1,2 +1,2 @@
-INSERT INTO users (name, email_hash, email_encrypted, google_id_hash, google_id_encrypted, first_name, last_name, avatar_url, is_admin)
-VALUES (:name, :email_hash, :email_encrypted, :google_id_hash, :google_id_encrypted, :first_name, :last_name, :avatar_url, :is_admin);
\ No newline at end of file
+INSERT INTO users (name, handle, email_hash, email_encrypted, google_id_hash, google_id_encrypted, first_name_encrypted, last_name_encrypted, avatar_url_encrypted, is_admin)
+VALUES (:name, :handle, :email_hash, :email_encrypted, :google_id_hash, :google_id_encrypted, :first_name_encrypted, :last_name_encrypted, :avatar_url_encrypted, :is_admin);
\ No newline at end of file
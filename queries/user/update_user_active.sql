@@ -0,0 +1,4 @@
+UPDATE users
+SET active = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND deleted_at IS NULL;
@@ -0,0 +1 @@
+UPDATE users SET is_admin = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?;
\ No newline at end of file
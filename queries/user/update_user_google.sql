@@ -1,10 +1,15 @@
 UPDATE users
-SET name = :name,
+SET name = IF(name_is_custom, name, :name),
     email_hash = :email_hash,
     email_encrypted = :email_encrypted,
-    first_name = :first_name,
-    last_name = :last_name,
-    avatar_url = :avatar_url,
+    google_id_hash = :google_id_hash,
+    google_id_encrypted = :google_id_encrypted,
+    first_name = NULL,
+    last_name = NULL,
+    avatar_url = NULL,
+    first_name_encrypted = :first_name_encrypted,
+    last_name_encrypted = :last_name_encrypted,
+    avatar_url_encrypted = :avatar_url_encrypted,
     is_admin = :is_admin,
     updated_at = CURRENT_TIMESTAMP
-WHERE google_id_hash = :google_id_hash;
\ No newline at end of file
+WHERE id = :id;
\ No newline at end of file
@@ -0,0 +1,9 @@
+UPDATE users
+SET name = :name,
+    name_is_custom = :name_is_custom,
+    notification_channels = :notification_channels,
+    dietary_profile_encrypted = :dietary_profile_encrypted,
+    pickup_location = :pickup_location,
+    timezone = :timezone,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = :id;
@@ -0,0 +1 @@
+UPDATE users SET name_visibility = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?;
\ No newline at end of file
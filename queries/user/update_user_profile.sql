@@ -0,0 +1,12 @@
+UPDATE users
+SET name = IF(name_is_custom, name, :name),
+    email_hash = :email_hash,
+    email_encrypted = :email_encrypted,
+    first_name = NULL,
+    last_name = NULL,
+    avatar_url = NULL,
+    first_name_encrypted = :first_name_encrypted,
+    last_name_encrypted = :last_name_encrypted,
+    avatar_url_encrypted = :avatar_url_encrypted,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = :id;
\ No newline at end of file
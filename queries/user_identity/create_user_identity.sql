@@ -0,0 +1,2 @@
+INSERT INTO user_identities (created_at, updated_at, user_id, provider, subject_hash, subject_encrypted)
+VALUES (NOW(), NOW(), :user_id, :provider, :subject_hash, :subject_encrypted);
\ No newline at end of file
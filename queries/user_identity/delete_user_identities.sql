@@ -0,0 +1 @@
+DELETE FROM user_identities WHERE user_id = ?;
\ No newline at end of file
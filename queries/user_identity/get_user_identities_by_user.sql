@@ -0,0 +1 @@
+SELECT * FROM user_identities WHERE user_id = ? ORDER BY created_at;
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT * FROM user_identities WHERE subject_hash IN (?);
\ No newline at end of file
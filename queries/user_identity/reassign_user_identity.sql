@@ -0,0 +1,6 @@
+UPDATE user_identities
+SET user_id = :user_id,
+    subject_hash = :subject_hash,
+    subject_encrypted = :subject_encrypted,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = :id;
\ No newline at end of file
@@ -0,0 +1,2 @@
+INSERT IGNORE INTO user_keys (user_id, wrapped_key)
+VALUES (:user_id, :wrapped_key);
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT * FROM user_keys WHERE user_id = ?;
\ No newline at end of file
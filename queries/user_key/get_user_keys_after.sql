@@ -0,0 +1 @@
+SELECT * FROM user_keys WHERE user_id > ? ORDER BY user_id LIMIT ?;
\ No newline at end of file
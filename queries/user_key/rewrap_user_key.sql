@@ -0,0 +1 @@
+UPDATE user_keys SET wrapped_key = ? WHERE user_id = ? AND wrapped_key = ?;
\ No newline at end of file
@@ -0,0 +1,2 @@
+INSERT INTO user_merges (source_user_id, target_user_id, merged_by_user_id, donations_moved, received_moved, requests_moved, identities_moved)
+VALUES (:source_user_id, :target_user_id, :merged_by_user_id, :donations_moved, :received_moved, :requests_moved, :identities_moved);
\ No newline at end of file
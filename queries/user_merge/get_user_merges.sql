@@ -0,0 +1 @@
+SELECT * FROM user_merges ORDER BY created_at DESC, id DESC;
\ No newline at end of file
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"lunchorder/queries"
+)
+
+type ApiTokenRepository struct {
+	db *sqlx.DB
+}
+
+func NewApiTokenRepository(db *sqlx.DB) *ApiTokenRepository {
+	return &ApiTokenRepository{
+		db: db,
+	}
+}
+
+// CreateApiToken stores the token; expiresInDays of 0 means it never expires
+func (r *ApiTokenRepository) CreateApiToken(token *ApiToken, expiresInDays int) error {
+	result, err := r.db.Exec(queries.CreateApiToken,
+		token.UserID, token.Name, token.TokenPrefix, token.TokenHash, token.Scopes,
+		expiresInDays, expiresInDays)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	token.ID = uint(id)
+	return nil
+}
+
+// GetActiveApiTokenByHash only returns tokens that are neither revoked nor expired
+func (r *ApiTokenRepository) GetActiveApiTokenByHash(tokenHash string) (*ApiToken, error) {
+	var token ApiToken
+	err := r.db.Get(&token, queries.GetActiveApiTokenByHash, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *ApiTokenRepository) GetApiTokensByUser(userID uint) ([]ApiToken, error) {
+	var tokens []ApiToken
+	err := r.db.Select(&tokens, queries.GetApiTokensByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// GetAllApiTokensByUser returns the user's tokens including revoked and expired ones
+func (r *ApiTokenRepository) GetAllApiTokensByUser(userID uint) ([]ApiToken, error) {
+	var tokens []ApiToken
+	err := r.db.Select(&tokens, queries.GetAllApiTokensByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *ApiTokenRepository) RevokeApiToken(id uint, userID uint) (bool, error) {
+	result, err := r.db.Exec(queries.RevokeApiToken, id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// TouchApiToken records use of the token, at most once a minute
+func (r *ApiTokenRepository) TouchApiToken(ctx context.Context, id uint) error {
+	_, err := r.db.ExecContext(ctx, queries.TouchApiToken, id)
+	return err
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"lunchorder/queries"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type AuditRepository struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepository(db *sqlx.DB) *AuditRepository {
+	return &AuditRepository{
+		db: db,
+	}
+}
+
+func (r *AuditRepository) CreateAuditEntry(entry *AuditEntry) error {
+	_, err := r.db.Exec(queries.CreateAuditEntry, entry.ActorUserID, entry.SubjectUserID, entry.Action, entry.Detail)
+	return err
+}
+
+// GetAuditLog returns the latest limit entries, newest first
+func (r *AuditRepository) GetAuditLog(limit int) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	err := r.db.Select(&entries, queries.GetAuditLog, limit)
+	return entries, err
+}
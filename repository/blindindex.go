@@ -0,0 +1,22 @@
+package repository
+
+import "github.com/jmoiron/sqlx"
+
+// getByBlindIndex runs a lookup whose query has a "hash IN (?)" placeholder.
+// It is given the hashes under every known data key so rows that have not been
+// rotated to the current key yet are still found.
+func getByBlindIndex(db *sqlx.DB, dest interface{}, query string, hashes []string) error {
+	query, args, err := sqlx.In(query, hashes)
+	if err != nil {
+		return err
+	}
+	return db.Get(dest, db.Rebind(query), args...)
+}
+
+// Blind index names. Each index is hashed with its own derived key.
+const (
+	userEmailIndex           = "users.email_hash"
+	userGoogleIDIndex        = "users.google_id_hash"
+	userIdentitySubjectIndex = "user_identities.subject_hash"
+	emailAccessEmailIndex    = "email_access_rules.email_hash"
+)
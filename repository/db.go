@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"fmt"
+	"lunchorder/config"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// Connect opens the configured MySQL database
+func Connect(database config.DatabaseConfig) (*sqlx.DB, error) {
+	// Add connection parameters for reliability and timeouts
+	finalString := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&multiStatements=true&timeout=10s&readTimeout=30s&writeTimeout=30s&charset=utf8mb4&collation=utf8mb4_unicode_ci",
+		database.User, database.Password, database.Host, database.Port, database.Name)
+
+	db, err := sqlx.Connect("mysql", finalString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Configure connection pool to prevent connection exhaustion and timeouts
+	db.SetMaxOpenConns(database.MaxOpenConns)       // Maximum number of open connections to the database
+	db.SetMaxIdleConns(database.MaxIdleConns)       // Maximum number of idle connections in the pool
+	db.SetConnMaxLifetime(database.ConnMaxLifetime) // Maximum lifetime of a connection (prevents stale connections)
+	db.SetConnMaxIdleTime(database.ConnMaxIdleTime) // Maximum time a connection can be idle
+
+	return db, nil
+}
@@ -1,9 +1,10 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"github.com/jmoiron/sqlx"
-	"log"
+	"log/slog"
 	"lunchorder/queries"
 	"time"
 )
@@ -23,7 +24,7 @@ func NewDonationRepository(db *sqlx.DB, userRepository *UserRepository) *Donatio
 }
 
 func (r *DonationRepository) CreateDonation(donation *Donation) error {
-	result, err := r.db.Exec(queries.CreateDonation, donation.MealID, donation.DonorID, donation.DonorID)
+	result, err := r.db.Exec(queries.CreateDonation, donation.MealID, donation.DonorID, donation.Anonymous, donation.DonorID)
 	if err != nil {
 		return err
 	}
@@ -40,10 +41,10 @@ func (r *DonationRepository) CreateDonation(donation *Donation) error {
 	return nil
 }
 
-func (r *DonationRepository) ClaimDonation(donationId uint, user *User) (bool, error) {
-	result, err := r.db.Exec(queries.ClaimDonation, user.ID, donationId)
+func (r *DonationRepository) ClaimDonation(ctx context.Context, donationId uint, user *User) (bool, error) {
+	result, err := r.db.ExecContext(ctx, queries.ClaimDonation, user.ID, donationId)
 	if err != nil {
-		log.Println("Failed to claim donation:", err)
+		slog.ErrorContext(ctx, "Failed to claim donation", "donation_id", donationId, "error", err)
 		return false, err
 	}
 
@@ -66,9 +67,9 @@ func (r *DonationRepository) GetUnclaimedDonationsByDate(date string) ([]Donatio
 		var u User
 
 		err := rows.Scan(
-			&d.ID, &d.CreatedAt, &d.UpdatedAt, &d.MealID, &d.DonorID, &d.RecipientID,
+			&d.ID, &d.CreatedAt, &d.UpdatedAt, &d.MealID, &d.DonorID, &d.RecipientID, &d.Anonymous,
 			&m.ID, &m.Description, &m.Date,
-			&u.ID, &u.Name,
+			&u.ID, &u.Name, &u.NameVisibility,
 		)
 		if err != nil {
 			return nil, err
@@ -98,12 +99,13 @@ func (r *DonationRepository) GetDonationsSummaryByDate(date string) (*[]Donation
 		var recipient User
 		var recipientID *uint
 		var recipientName *string
+		var recipientNameVisibility *string
 
 		err := rows.Scan(
-			&d.ID, &d.CreatedAt, &d.UpdatedAt, &d.MealID, &d.DonorID, &d.RecipientID,
+			&d.ID, &d.CreatedAt, &d.UpdatedAt, &d.MealID, &d.DonorID, &d.RecipientID, &d.Anonymous,
 			&m.ID, &m.Description, &m.Date,
-			&donor.ID, &donor.Name,
-			&recipientID, &recipientName,
+			&donor.ID, &donor.Name, &donor.NameVisibility,
+			&recipientID, &recipientName, &recipientNameVisibility,
 		)
 
 		if err != nil {
@@ -118,6 +120,9 @@ func (r *DonationRepository) GetDonationsSummaryByDate(date string) (*[]Donation
 			if recipientName != nil {
 				recipient.Name = *recipientName
 			}
+			if recipientNameVisibility != nil {
+				recipient.NameVisibility = *recipientNameVisibility
+			}
 			d.Recipient = recipient
 		}
 
@@ -127,17 +132,17 @@ func (r *DonationRepository) GetDonationsSummaryByDate(date string) (*[]Donation
 	return &donations, nil
 }
 
-func (r *DonationRepository) GetDonationClaimByClaimantName(name string) (Donation, error) {
+func (r *DonationRepository) GetDonationClaimByRecipientID(recipientID uint) (Donation, error) {
 	var d Donation
 	var m Meal
 	var donor User
 
-	row := r.db.QueryRowx(queries.GetDonationClaimByName, name, time.Now())
+	row := r.db.QueryRowx(queries.GetDonationClaimByRecipient, recipientID, time.Now())
 
 	err := row.Scan(
-		&d.ID, &d.CreatedAt, &d.UpdatedAt, &d.MealID, &d.DonorID, &d.RecipientID,
+		&d.ID, &d.CreatedAt, &d.UpdatedAt, &d.MealID, &d.DonorID, &d.RecipientID, &d.Anonymous,
 		&m.ID, &m.Description, &m.Date,
-		&donor.ID, &donor.Name,
+		&donor.ID, &donor.Name, &donor.NameVisibility,
 	)
 
 	if err != nil {
@@ -149,3 +154,83 @@ func (r *DonationRepository) GetDonationClaimByClaimantName(name string) (Donati
 
 	return d, nil
 }
+
+func (r *DonationRepository) GetDonationByID(id uint) (Donation, error) {
+	var d Donation
+	var m Meal
+	var donor User
+
+	row := r.db.QueryRowx(queries.GetDonationByID, id)
+
+	err := row.Scan(
+		&d.ID, &d.CreatedAt, &d.UpdatedAt, &d.MealID, &d.DonorID, &d.RecipientID, &d.CollectedAt, &d.Anonymous,
+		&m.ID, &m.Description, &m.Date,
+		&donor.ID, &donor.Name, &donor.NameVisibility,
+	)
+
+	if err != nil {
+		return d, err
+	}
+
+	d.Meal = m
+	d.Donor = donor
+
+	return d, nil
+}
+
+func (r *DonationRepository) MarkDonationCollected(ctx context.Context, donationId uint, recipientId uint) (bool, error) {
+	result, err := r.db.ExecContext(ctx, queries.MarkDonationCollected, donationId, recipientId)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to mark donation collected", "donation_id", donationId, "error", err)
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// GetDonationsByUser returns every donation the user gave or received
+func (r *DonationRepository) GetDonationsByUser(userID uint) ([]Donation, error) {
+	var donations []Donation
+
+	rows, err := r.db.Queryx(queries.GetDonationsByUser, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d Donation
+		var m Meal
+		var donor User
+		var recipientName *string
+		var recipientNameVisibility *string
+
+		err := rows.Scan(
+			&d.ID, &d.CreatedAt, &d.UpdatedAt, &d.MealID, &d.DonorID, &d.RecipientID, &d.CollectedAt, &d.Anonymous,
+			&m.ID, &m.Description, &m.Date,
+			&donor.ID, &donor.Name, &donor.NameVisibility,
+			&recipientName, &recipientNameVisibility,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Meal = m
+		d.Donor = donor
+
+		if d.RecipientID != nil {
+			d.Recipient.ID = *d.RecipientID
+			if recipientName != nil {
+				d.Recipient.Name = *recipientName
+			}
+			if recipientNameVisibility != nil {
+				d.Recipient.NameVisibility = *recipientNameVisibility
+			}
+		}
+
+		donations = append(donations, d)
+	}
+
+	return donations, rows.Err()
+}
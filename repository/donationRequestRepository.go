@@ -46,11 +46,7 @@ func (r *DonationRequestRepository) CreateDonationRequest(requesterID uint, meal
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-
-	return r.CheckAndFulfillDonationRequests()
+	return tx.Commit()
 }
 
 func (r *DonationRequestRepository) GetDonationRequestsByStatus(status string) ([]DonationRequest, error) {
@@ -68,7 +64,7 @@ func (r *DonationRequestRepository) GetDonationRequestsByStatus(status string) (
 		
 		err := rows.Scan(
 			&dr.ID, &dr.CreatedAt, &dr.UpdatedAt, &dr.RequesterID, &dr.Status, &dr.DonationID,
-			&u.ID, &u.Name,
+			&u.ID, &u.Name, &u.NameVisibility,
 		)
 		if err != nil {
 			return nil, err
@@ -85,14 +81,9 @@ func (r *DonationRequestRepository) UpdateDonationRequestStatus(requestID uint,
 	return err
 }
 
-func (r *DonationRequestRepository) GetDonationRequestsByRequesterName(requesterName string, date string) ([]DonationRequest, error) {
-	user, err := r.userRepository.GetUserByName(requesterName)
-	if err != nil {
-		return nil, err
-	}
-
+func (r *DonationRequestRepository) GetDonationRequestsByRequesterID(requesterID uint, date string) ([]DonationRequest, error) {
 	var requests []DonationRequest
-	rows, err := r.db.Queryx(queries.GetRequestsByRequester, user.ID, date)
+	rows, err := r.db.Queryx(queries.GetRequestsByRequester, requesterID, date)
 	if err != nil {
 		return nil, err
 	}
@@ -152,18 +143,43 @@ func (r *DonationRequestRepository) GetDonationRequestsByRequesterName(requester
 	return requests, nil
 }
 
+// GetAllDonationRequestsByRequester returns every request the user made, whatever its status or date
+func (r *DonationRequestRepository) GetAllDonationRequestsByRequester(requesterID uint) ([]DonationRequest, error) {
+	var requests []DonationRequest
+	rows, err := r.db.Queryx(queries.GetAllRequestsByRequester, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dr DonationRequest
+		err := rows.Scan(&dr.ID, &dr.CreatedAt, &dr.UpdatedAt, &dr.RequesterID, &dr.Status, &dr.DonationID)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, dr)
+	}
+
+	return requests, rows.Err()
+}
+
 func (r *DonationRequestRepository) GetDonationRequestMealPreferences(requestID uint) ([]Meal, error) {
 	var meals []Meal
 	err := r.db.Select(&meals, queries.GetRequestMeals, requestID)
 	return meals, err
 }
 
-func (r *DonationRequestRepository) CheckAndFulfillDonationRequests() error {
+// CheckAndFulfillDonationRequests matches pending requests with unclaimed
+// donations and returns how many it fulfilled
+func (r *DonationRequestRepository) CheckAndFulfillDonationRequests() (int, error) {
 	pendingRequests, err := r.GetDonationRequestsByStatus("pending")
 	if err != nil {
-		return err
+		return 0, err
 	}
 
+	fulfilled := 0
+
 	for _, request := range pendingRequests {
 		preferredMeals, err := r.GetDonationRequestMealPreferences(request.ID)
 		if err != nil || len(preferredMeals) == 0 {
@@ -205,7 +221,7 @@ func (r *DonationRequestRepository) CheckAndFulfillDonationRequests() error {
 		// Fulfill
 		tx, err := r.db.Beginx()
 		if err != nil {
-			return err
+			return fulfilled, err
 		}
 
 		// Update Donation
@@ -222,8 +238,10 @@ func (r *DonationRequestRepository) CheckAndFulfillDonationRequests() error {
 			continue
 		}
 
-		tx.Commit()
+		if tx.Commit() == nil {
+			fulfilled++
+		}
 	}
 
-	return nil
+	return fulfilled, nil
 }
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"lunchorder/queries"
+	"lunchorder/utils"
+	"strings"
+)
+
+type EmailAccessRepository struct {
+	db   *sqlx.DB
+	keys *utils.DataKeys
+}
+
+func NewEmailAccessRepository(db *sqlx.DB, keys *utils.DataKeys) *EmailAccessRepository {
+	return &EmailAccessRepository{
+		db:   db,
+		keys: keys,
+	}
+}
+
+// normalizeEmail makes rule lookups case-insensitive
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func (r *EmailAccessRepository) UpsertRule(rule *EmailAccessRule) error {
+	rule.Email = normalizeEmail(rule.Email)
+
+	if err := utils.SealFields(r.keys, "email_access_rules", rule); err != nil {
+		return err
+	}
+
+	// A rule stored under an older key has a different hash, so the upsert
+	// would not see it; update it in place instead, rotating it as a side effect
+	existing, err := r.GetRuleByEmail(rule.Email)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		rule.ID = existing.ID
+		_, err = r.db.NamedExec(queries.UpdateEmailAccessRule, rule)
+		return err
+	}
+
+	_, err = r.db.NamedExec(queries.UpsertEmailAccessRule, rule)
+	return err
+}
+
+// GetRuleByEmail returns nil when no rule exists for the address
+func (r *EmailAccessRepository) GetRuleByEmail(email string) (*EmailAccessRule, error) {
+	var rule EmailAccessRule
+	err := getByBlindIndex(r.db, &rule, queries.GetEmailAccessRuleByEmail, r.keys.Hashes(emailAccessEmailIndex, normalizeEmail(email)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decryptRule(&rule); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *EmailAccessRepository) GetRules() ([]EmailAccessRule, error) {
+	var rules []EmailAccessRule
+	err := r.db.Select(&rules, queries.GetEmailAccessRules)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if err := r.decryptRule(&rules[i]); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+func (r *EmailAccessRepository) DeleteRule(id uint) (bool, error) {
+	result, err := r.db.Exec(queries.DeleteEmailAccessRule, id)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (r *EmailAccessRepository) decryptRule(rule *EmailAccessRule) error {
+	return utils.OpenFields(r.keys, rule)
+}
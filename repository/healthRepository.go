@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"lunchorder/queries"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MigrationVersion is the row golang-migrate keeps in schema_migrations.
+// Dirty means a migration failed halfway and needs fixing by hand.
+type MigrationVersion struct {
+	Version uint `db:"version"`
+	Dirty   bool `db:"dirty"`
+}
+
+type HealthRepository struct {
+	db *sqlx.DB
+}
+
+func NewHealthRepository(db *sqlx.DB) *HealthRepository {
+	return &HealthRepository{
+		db: db,
+	}
+}
+
+func (r *HealthRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+func (r *HealthRepository) GetMigrationVersion(ctx context.Context) (*MigrationVersion, error) {
+	var version MigrationVersion
+	if err := r.db.GetContext(ctx, &version, queries.GetMigrationVersion); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
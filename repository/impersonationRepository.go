@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"lunchorder/queries"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ImpersonationRepository struct {
+	db *sqlx.DB
+}
+
+func NewImpersonationRepository(db *sqlx.DB) *ImpersonationRepository {
+	return &ImpersonationRepository{
+		db: db,
+	}
+}
+
+// CreateImpersonation stores an impersonation expiring ttl from now, measured by the database clock
+func (r *ImpersonationRepository) CreateImpersonation(impersonation *Impersonation, ttl time.Duration) error {
+	_, err := r.db.Exec(queries.CreateImpersonation,
+		impersonation.ID, impersonation.AdminUserID, impersonation.AdminSessionID, impersonation.UserID,
+		impersonation.Reason, impersonation.AllowWrites, int64(ttl.Seconds()))
+	return err
+}
+
+func (r *ImpersonationRepository) GetImpersonationByID(id string) (*Impersonation, error) {
+	var impersonation Impersonation
+	err := r.db.Get(&impersonation, queries.GetImpersonationByID, id)
+	if err != nil {
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+// GetActiveImpersonation only returns impersonations that have neither ended nor expired
+func (r *ImpersonationRepository) GetActiveImpersonation(id string) (*Impersonation, error) {
+	var impersonation Impersonation
+	err := r.db.Get(&impersonation, queries.GetActiveImpersonation, id)
+	if err != nil {
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+// GetActiveAdminImpersonations returns the running impersonations started by the admin
+func (r *ImpersonationRepository) GetActiveAdminImpersonations(adminUserID uint) ([]Impersonation, error) {
+	var impersonations []Impersonation
+	err := r.db.Select(&impersonations, queries.GetActiveAdminImpersonations, adminUserID)
+	if err != nil {
+		return nil, err
+	}
+	return impersonations, nil
+}
+
+// EndImpersonation returns false if the impersonation had already ended
+func (r *ImpersonationRepository) EndImpersonation(id string) (bool, error) {
+	result, err := r.db.Exec(queries.EndImpersonation, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
@@ -0,0 +1,456 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lunchorder/utils"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// EncryptedTable is a table keyed by an auto-increment id whose model has encrypted fields
+type EncryptedTable struct {
+	Name   string
+	Fields []utils.EncryptedField
+	// UserIDColumn names the column holding the id of the user whose key
+	// encrypts the row; empty for tables encrypted with the data keys
+	UserIDColumn string
+	// DeletedAtColumn names the column set once a row has been erased; empty
+	// for tables whose rows are deleted outright
+	DeletedAtColumn string
+}
+
+// EncryptedTables are all tables holding encrypted data
+var EncryptedTables = []EncryptedTable{
+	{Name: "users", Fields: utils.EncryptedFields(User{}), UserIDColumn: "id", DeletedAtColumn: "deleted_at"},
+	{Name: "user_identities", Fields: utils.EncryptedFields(UserIdentity{}), UserIDColumn: "user_id"},
+	{Name: "email_access_rules", Fields: utils.EncryptedFields(EmailAccessRule{})},
+}
+
+// RotationBatch reports the outcome of one RotateBatch call
+type RotationBatch struct {
+	// LastID is the highest id scanned; pass it as afterID to continue
+	LastID  uint
+	Scanned int
+	Rotated int
+	// Skipped counts rows changed by someone else between read and write.
+	// Any such write already used the current key.
+	Skipped int
+}
+
+type KeyRotationRepository struct {
+	db       *sqlx.DB
+	userKeys *UserKeyRepository
+}
+
+func NewKeyRotationRepository(db *sqlx.DB, userKeys *UserKeyRepository) *KeyRotationRepository {
+	return &KeyRotationRepository{
+		db:       db,
+		userKeys: userKeys,
+	}
+}
+
+// encryptedRow holds, per field, the ciphertext, legacy plaintext and hash
+// columns as read, and the plaintext they decrypt to
+type encryptedRow struct {
+	id        uint
+	userID    uint
+	deleted   bool
+	encrypted []sql.NullString
+	legacy    []sql.NullString
+	hash      []sql.NullString
+	plaintext []sql.NullString
+}
+
+// hasValues reports whether any field of the row holds a value
+func (row *encryptedRow) hasValues() bool {
+	return slices.ContainsFunc(row.plaintext, func(value sql.NullString) bool { return value.Valid })
+}
+
+// RotateBatch brings up to limit rows of table with ids above afterID up to
+// date: values are re-encrypted with the user's key (or the current data key),
+// moved out of legacy plaintext columns, and re-hashed with the current blind
+// index keys. Each row is updated only if it is unchanged since it was read,
+// so it is safe to run while the app is serving traffic, and rows already up
+// to date are left alone, so an interrupted run can simply be restarted.
+// Erased rows are skipped, and a user only gets a key when one of their rows
+// has to be written, so the key shredded with an erased user is never recreated.
+func (r *KeyRotationRepository) RotateBatch(table EncryptedTable, afterID uint, limit int) (RotationBatch, error) {
+	batch := RotationBatch{LastID: afterID}
+
+	rows, err := r.readRows(table, afterID, limit)
+	if err != nil {
+		return batch, err
+	}
+
+	for _, row := range rows {
+		batch.Scanned++
+		batch.LastID = row.id
+		if row.deleted {
+			continue
+		}
+
+		var cipher utils.FieldCipher = r.userKeys.DataKeys()
+		var userCipher *utils.UserCipher
+		if table.UserIDColumn != "" {
+			if userCipher, err = r.userKeys.Cipher(row.userID); err != nil {
+				return batch, fmt.Errorf("%s id %d: %w", table.Name, row.id, err)
+			}
+			cipher = userCipher
+		}
+		current, err := decryptRow(table, cipher, &row)
+		if err != nil {
+			return batch, fmt.Errorf("%s id %d: %w", table.Name, row.id, err)
+		}
+		// Values of a user without a key are moved to one of their own
+		if userCipher != nil && !userCipher.HasKey() && row.hasValues() {
+			current = false
+		}
+		if current {
+			continue
+		}
+
+		if userCipher != nil {
+			if cipher, err = r.userKeys.CipherForWrite(row.userID); err != nil {
+				return batch, fmt.Errorf("%s id %d: %w", table.Name, row.id, err)
+			}
+		}
+
+		updated, err := r.rotateRow(table, cipher, row)
+		if err != nil {
+			return batch, fmt.Errorf("%s id %d: %w", table.Name, row.id, err)
+		}
+		if updated {
+			batch.Rotated++
+		} else {
+			batch.Skipped++
+		}
+	}
+
+	return batch, nil
+}
+
+// HasPlaintext reports whether any row of table, erased rows aside, still
+// holds a value in a legacy plaintext column
+func (r *KeyRotationRepository) HasPlaintext(table EncryptedTable) (bool, error) {
+	var conditions []string
+	for _, field := range table.Fields {
+		if field.Plaintext != "" {
+			conditions = append(conditions, field.Plaintext+" IS NOT NULL")
+		}
+	}
+	if len(conditions) == 0 {
+		return false, nil
+	}
+	where := "(" + strings.Join(conditions, " OR ") + ")"
+	if table.DeletedAtColumn != "" {
+		where += " AND " + table.DeletedAtColumn + " IS NULL"
+	}
+
+	var exists bool
+	err := r.db.Get(&exists, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s)", table.Name, where))
+	return exists, err
+}
+
+func (r *KeyRotationRepository) readRows(table EncryptedTable, afterID uint, limit int) ([]encryptedRow, error) {
+	userIDColumn := "0"
+	if table.UserIDColumn != "" {
+		userIDColumn = table.UserIDColumn
+	}
+	deleted := "FALSE"
+	if table.DeletedAtColumn != "" {
+		deleted = table.DeletedAtColumn + " IS NOT NULL"
+	}
+	columns := []string{"id", userIDColumn, deleted}
+	for _, field := range table.Fields {
+		columns = append(columns, field.Encrypted, nullColumn(field.Plaintext), nullColumn(field.Hash))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE id > ? ORDER BY id LIMIT ?",
+		strings.Join(columns, ", "), table.Name)
+
+	rows, err := r.db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []encryptedRow
+	for rows.Next() {
+		n := len(table.Fields)
+		row := encryptedRow{
+			encrypted: make([]sql.NullString, n),
+			legacy:    make([]sql.NullString, n),
+			hash:      make([]sql.NullString, n),
+			plaintext: make([]sql.NullString, n),
+		}
+		dest := []interface{}{&row.id, &row.userID, &row.deleted}
+		for i := 0; i < n; i++ {
+			dest = append(dest, &row.encrypted[i], &row.legacy[i], &row.hash[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// decryptRow fills in the row's plaintexts and reports whether it is up to date
+func decryptRow(table EncryptedTable, cipher utils.FieldCipher, row *encryptedRow) (bool, error) {
+	current := true
+	for i, field := range table.Fields {
+		switch {
+		case row.encrypted[i].Valid:
+			plaintext, err := cipher.Decrypt(row.encrypted[i].String)
+			if err != nil {
+				return false, fmt.Errorf("%s: %w", field.Encrypted, err)
+			}
+			row.plaintext[i] = sql.NullString{String: plaintext, Valid: true}
+			if !cipher.IsCurrent(row.encrypted[i].String) {
+				current = false
+			}
+		case row.legacy[i].Valid:
+			row.plaintext[i] = row.legacy[i]
+		}
+
+		if row.legacy[i].Valid {
+			current = false
+		}
+		if field.Hash != "" && row.plaintext[i].Valid &&
+			row.hash[i].String != cipher.Hash(table.Name+"."+field.Hash, row.plaintext[i].String) {
+			current = false
+		}
+	}
+	return current, nil
+}
+
+func (r *KeyRotationRepository) rotateRow(table EncryptedTable, cipher utils.FieldCipher, row encryptedRow) (bool, error) {
+	var set, where []string
+	var setArgs, whereArgs []interface{}
+
+	for i, field := range table.Fields {
+		where = append(where, field.Encrypted+" <=> ?")
+		whereArgs = append(whereArgs, row.encrypted[i])
+		if field.Plaintext != "" {
+			where = append(where, field.Plaintext+" <=> ?")
+			whereArgs = append(whereArgs, row.legacy[i])
+		}
+
+		if !row.plaintext[i].Valid {
+			continue
+		}
+		plaintext := row.plaintext[i].String
+
+		encrypted := row.encrypted[i].String
+		if !row.encrypted[i].Valid || !cipher.IsCurrent(encrypted) {
+			var err error
+			if encrypted, err = cipher.Encrypt(plaintext); err != nil {
+				return false, err
+			}
+		}
+		set = append(set, field.Encrypted+" = ?")
+		setArgs = append(setArgs, encrypted)
+		if field.Hash != "" {
+			set = append(set, field.Hash+" = ?")
+			setArgs = append(setArgs, cipher.Hash(table.Name+"."+field.Hash, plaintext))
+		}
+		if field.Plaintext != "" {
+			set = append(set, field.Plaintext+" = NULL")
+		}
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = ? AND %s",
+		table.Name, strings.Join(set, ", "), strings.Join(where, " AND "))
+	args := append(append(setArgs, row.id), whereArgs...)
+
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// nullColumn selects column, or NULL for a field without one
+func nullColumn(column string) string {
+	if column == "" {
+		return "NULL"
+	}
+	return column
+}
+
+// Problems found by VerifyBatch
+const (
+	// IntegrityUndecryptable: the ciphertext does not decrypt with any key
+	IntegrityUndecryptable = "undecryptable"
+	// IntegrityKeyShredded: the ciphertext was written with a user key that has been deleted
+	IntegrityKeyShredded = "key_shredded"
+	// IntegrityHashMissing: a value has no blind index, so lookups cannot find it
+	IntegrityHashMissing = "hash_missing"
+	// IntegrityHashMismatch: the blind index does not match the value under any data key
+	IntegrityHashMismatch = "hash_mismatch"
+	// IntegrityOrphanHash: a blind index is set but there is no value
+	IntegrityOrphanHash = "orphan_hash"
+	// IntegrityLegacyHash: the blind index was computed with a data key itself
+	// rather than its sub-key, and is only found while legacy hashes are on
+	IntegrityLegacyHash = "legacy_hash"
+	// IntegrityPlaintextPresent: a legacy plaintext column still holds the value
+	IntegrityPlaintextPresent = "plaintext_present"
+)
+
+// unrepairableProblems are the problems repairing hashes does not fix
+var unrepairableProblems = []string{IntegrityUndecryptable, IntegrityKeyShredded, IntegrityPlaintextPresent}
+
+// IntegrityIssue is one broken encrypted column of one row
+type IntegrityIssue struct {
+	Table    string `json:"table"`
+	ID       uint   `json:"id"`
+	Column   string `json:"column"`
+	Problem  string `json:"problem"`
+	Detail   string `json:"detail,omitempty"`
+	Repaired bool   `json:"repaired"`
+}
+
+// VerificationBatch reports the outcome of one VerifyBatch call
+type VerificationBatch struct {
+	// LastID is the highest id scanned; pass it as afterID to continue
+	LastID  uint
+	Scanned int
+	Issues  []IntegrityIssue
+}
+
+// VerifyBatch checks up to limit rows of table with ids above afterID: every
+// ciphertext must decrypt and every blind index must match its value under
+// one of the data keys. Hashes written with an older data key are fine; they
+// are brought up to date by RotateBatch. Hashes written with a data key itself
+// are reported as legacy. With repair, wrong, missing, orphaned and legacy
+// hashes are recomputed from the decrypted value, if the row is
+// unchanged since it was read. Undecryptable values cannot be repaired here,
+// and plaintext left in legacy columns is only moved out by RotateBatch.
+// Unlike RotateBatch, it never creates user keys.
+func (r *KeyRotationRepository) VerifyBatch(table EncryptedTable, afterID uint, limit int, repair bool) (VerificationBatch, error) {
+	batch := VerificationBatch{LastID: afterID}
+
+	rows, err := r.readRows(table, afterID, limit)
+	if err != nil {
+		return batch, err
+	}
+
+	for _, row := range rows {
+		batch.Scanned++
+		batch.LastID = row.id
+
+		var cipher utils.FieldCipher = r.userKeys.DataKeys()
+		if table.UserIDColumn != "" {
+			if cipher, err = r.userKeys.Cipher(row.userID); err != nil {
+				return batch, fmt.Errorf("%s id %d: %w", table.Name, row.id, err)
+			}
+		}
+
+		issues, hashes := r.verifyRow(table, cipher, &row)
+		if repair && len(hashes) > 0 {
+			repaired, err := r.repairHashes(table, row, hashes)
+			if err != nil {
+				return batch, fmt.Errorf("%s id %d: %w", table.Name, row.id, err)
+			}
+			for i := range issues {
+				issues[i].Repaired = repaired && !slices.Contains(unrepairableProblems, issues[i].Problem)
+			}
+		}
+		batch.Issues = append(batch.Issues, issues...)
+	}
+
+	return batch, nil
+}
+
+// verifyRow decrypts the row's fields and returns its issues, along with the
+// correct value (NULL for orphans) of every hash column in need of repair
+func (r *KeyRotationRepository) verifyRow(table EncryptedTable, cipher utils.FieldCipher, row *encryptedRow) ([]IntegrityIssue, map[int]sql.NullString) {
+	var issues []IntegrityIssue
+	hashes := map[int]sql.NullString{}
+	issue := func(column string, problem string, detail string) {
+		issues = append(issues, IntegrityIssue{Table: table.Name, ID: row.id, Column: column, Problem: problem, Detail: detail})
+	}
+
+	for i, field := range table.Fields {
+		switch {
+		case row.encrypted[i].Valid && row.encrypted[i].String != "":
+			plaintext, err := cipher.Decrypt(row.encrypted[i].String)
+			if errors.Is(err, utils.ErrUserKeyShredded) {
+				issue(field.Encrypted, IntegrityKeyShredded, "")
+				continue
+			}
+			if err != nil {
+				issue(field.Encrypted, IntegrityUndecryptable, err.Error())
+				continue
+			}
+			row.plaintext[i] = sql.NullString{String: plaintext, Valid: true}
+		case row.legacy[i].Valid:
+			row.plaintext[i] = row.legacy[i]
+		}
+		if row.legacy[i].Valid {
+			issue(field.Plaintext, IntegrityPlaintextPresent, "")
+		}
+
+		if field.Hash == "" {
+			continue
+		}
+		index := table.Name + "." + field.Hash
+		switch {
+		case !row.plaintext[i].Valid:
+			if row.hash[i].Valid && row.hash[i].String != "" {
+				issue(field.Hash, IntegrityOrphanHash, "")
+				hashes[i] = sql.NullString{}
+			}
+		case !row.hash[i].Valid || row.hash[i].String == "":
+			issue(field.Hash, IntegrityHashMissing, "")
+			hashes[i] = sql.NullString{String: cipher.Hash(index, row.plaintext[i].String), Valid: true}
+		case slices.Contains(r.userKeys.DataKeys().LegacyHashes(row.plaintext[i].String), row.hash[i].String):
+			issue(field.Hash, IntegrityLegacyHash, "")
+			hashes[i] = sql.NullString{String: cipher.Hash(index, row.plaintext[i].String), Valid: true}
+		case !slices.Contains(r.userKeys.BlindIndexes(index, row.plaintext[i].String), row.hash[i].String):
+			issue(field.Hash, IntegrityHashMismatch, "")
+			hashes[i] = sql.NullString{String: cipher.Hash(index, row.plaintext[i].String), Valid: true}
+		}
+	}
+	return issues, hashes
+}
+
+// repairHashes writes the given hash columns if the row is unchanged since it was read
+func (r *KeyRotationRepository) repairHashes(table EncryptedTable, row encryptedRow, hashes map[int]sql.NullString) (bool, error) {
+	var set, where []string
+	var setArgs, whereArgs []interface{}
+
+	for i, field := range table.Fields {
+		where = append(where, field.Encrypted+" <=> ?")
+		whereArgs = append(whereArgs, row.encrypted[i])
+		if field.Plaintext != "" {
+			where = append(where, field.Plaintext+" <=> ?")
+			whereArgs = append(whereArgs, row.legacy[i])
+		}
+		if field.Hash == "" {
+			continue
+		}
+		where = append(where, field.Hash+" <=> ?")
+		whereArgs = append(whereArgs, row.hash[i])
+
+		if hash, ok := hashes[i]; ok {
+			set = append(set, field.Hash+" = ?")
+			setArgs = append(setArgs, hash)
+		}
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id = ? AND %s",
+		table.Name, strings.Join(set, ", "), strings.Join(where, " AND "))
+	args := append(append(setArgs, row.id), whereArgs...)
+
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
@@ -11,20 +11,51 @@ type Meal struct {
 }
 
 type User struct {
-	ID                uint       `db:"id"`
-	CreatedAt         time.Time  `db:"created_at"`
-	UpdatedAt         time.Time  `db:"updated_at"`
-	Name              string     `json:"name" db:"name"`
-	Email             *string    `json:"email" db:"-"`
-	GoogleID          *string    `json:"googleId" db:"-"`
-	EmailHash         *string    `json:"-" db:"email_hash"`
-	EmailEncrypted    *string    `json:"-" db:"email_encrypted"`
-	GoogleIDHash      *string    `json:"-" db:"google_id_hash"`
-	GoogleIDEncrypted *string    `json:"-" db:"google_id_encrypted"`
-	FirstName         *string    `json:"firstName" db:"first_name"`
-	LastName          *string    `json:"lastName" db:"last_name"`
-	AvatarURL         *string    `json:"avatarUrl" db:"avatar_url"`
-	IsAdmin           bool       `json:"isAdmin" db:"is_admin"`
+	ID                      uint       `json:"id" db:"id"`
+	CreatedAt               time.Time  `db:"created_at"`
+	UpdatedAt               time.Time  `db:"updated_at"`
+	Handle                  string     `json:"handle" db:"handle"` // unique and never changes
+	Name                    string     `json:"name" db:"name"`     // display name only
+	Email                   *string    `json:"email" db:"-" encrypt:"email_encrypted" blindindex:"email_hash"`
+	GoogleID                *string    `json:"googleId" db:"-" encrypt:"google_id_encrypted" blindindex:"google_id_hash"`
+	EmailHash               *string    `json:"-" db:"email_hash"`
+	EmailEncrypted          *string    `json:"-" db:"email_encrypted"`
+	GoogleIDHash            *string    `json:"-" db:"google_id_hash"`
+	GoogleIDEncrypted       *string    `json:"-" db:"google_id_encrypted"`
+	FirstName               *string    `json:"firstName" db:"first_name" encrypt:"first_name_encrypted"`
+	LastName                *string    `json:"lastName" db:"last_name" encrypt:"last_name_encrypted"`
+	AvatarURL               *string    `json:"avatarUrl" db:"avatar_url" encrypt:"avatar_url_encrypted"`
+	FirstNameEncrypted      *string    `json:"-" db:"first_name_encrypted"`
+	LastNameEncrypted       *string    `json:"-" db:"last_name_encrypted"`
+	AvatarURLEncrypted      *string    `json:"-" db:"avatar_url_encrypted"`
+	IsAdmin                 bool       `json:"isAdmin" db:"is_admin"`
+	Active                  bool       `json:"active" db:"active"`                                        // false once deactivated, e.g. through SCIM
+	NameVisibility          string     `json:"nameVisibility" db:"name_visibility"`                       // "everyone", "admins", "nobody"
+	NameIsCustom            bool       `json:"-" db:"name_is_custom"`                                     // set by the user, kept on sign-in
+	NotificationChannels    string     `json:"notificationChannels" db:"notification_channels"`           // comma-separated
+	DietaryProfile          *string    `json:"dietaryProfile" db:"-" encrypt:"dietary_profile_encrypted"` // comma-separated
+	DietaryProfileEncrypted *string    `json:"-" db:"dietary_profile_encrypted"`
+	PickupLocation          *string    `json:"pickupLocation" db:"pickup_location"`
+	Timezone                *string    `json:"timezone" db:"timezone"` // IANA name, nil for the server's
+	DeletedAt               *time.Time `json:"-" db:"deleted_at"`
+}
+
+type UserIdentity struct {
+	ID               uint      `db:"id"`
+	CreatedAt        time.Time `db:"created_at"`
+	UpdatedAt        time.Time `db:"updated_at"`
+	UserID           uint      `db:"user_id"`
+	Provider         string    `db:"provider"`
+	Subject          string    `db:"-" encrypt:"subject_encrypted" blindindex:"subject_hash"`
+	SubjectHash      string    `db:"subject_hash"`
+	SubjectEncrypted string    `db:"subject_encrypted"`
+}
+
+type UserKey struct {
+	UserID     uint      `db:"user_id"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+	WrappedKey string    `db:"wrapped_key"`
 }
 
 type Donation struct {
@@ -37,6 +68,8 @@ type Donation struct {
 	Donor       User       `json:"donor" db:"donor"`
 	RecipientID *uint      `json:"recipientId" db:"recipient_id"`
 	Recipient   User       `json:"recipient" db:"recipient"`
+	CollectedAt *time.Time `json:"collectedAt" db:"collected_at"`
+	Anonymous   bool       `json:"anonymous" db:"anonymous"`
 }
 
 type DonationRequest struct {
@@ -54,4 +87,76 @@ type DonationRequestMeal struct {
 	DonationRequestID uint `db:"donation_request_id"`
 	MealID            uint `db:"meal_id"`
 	Meal              Meal `db:"meal"`
-}
\ No newline at end of file
+}
+
+type EmailAccessRule struct {
+	ID             uint      `db:"id"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+	Email          string    `json:"email" db:"-" encrypt:"email_encrypted" blindindex:"email_hash"`
+	EmailHash      string    `json:"-" db:"email_hash"`
+	EmailEncrypted string    `json:"-" db:"email_encrypted"`
+	Rule           string    `json:"rule" db:"rule"` // "allow", "deny"
+}
+
+type Session struct {
+	ID               string     `db:"id"`
+	CreatedAt        time.Time  `db:"created_at"`
+	UpdatedAt        time.Time  `db:"updated_at"`
+	UserID           uint       `db:"user_id"`
+	RefreshTokenHash string     `db:"refresh_token_hash"`
+	PreviousHash     *string    `db:"previous_refresh_token_hash"`
+	RotatedAt        *time.Time `db:"rotated_at"`
+	ExpiresAt        time.Time  `db:"expires_at"`
+	LastUsedAt       *time.Time `db:"last_used_at"`
+	RevokedAt        *time.Time `db:"revoked_at"`
+}
+
+type ApiToken struct {
+	ID          uint       `db:"id"`
+	CreatedAt   time.Time  `db:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at"`
+	UserID      uint       `db:"user_id"`
+	Name        string     `db:"name"`
+	TokenPrefix string     `db:"token_prefix"`
+	TokenHash   string     `db:"token_hash"`
+	Scopes      string     `db:"scopes"` // comma-separated
+	ExpiresAt   *time.Time `db:"expires_at"`
+	LastUsedAt  *time.Time `db:"last_used_at"`
+	RevokedAt   *time.Time `db:"revoked_at"`
+}
+
+type UserMerge struct {
+	ID              uint      `db:"id"`
+	CreatedAt       time.Time `db:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at"`
+	SourceUserID    uint      `db:"source_user_id"`
+	TargetUserID    uint      `db:"target_user_id"`
+	MergedByUserID  uint      `db:"merged_by_user_id"`
+	DonationsMoved  uint      `db:"donations_moved"`
+	ReceivedMoved   uint      `db:"received_moved"`
+	RequestsMoved   uint      `db:"requests_moved"`
+	IdentitiesMoved uint      `db:"identities_moved"`
+}
+
+type AuditEntry struct {
+	ID            uint      `db:"id"`
+	CreatedAt     time.Time `db:"created_at"`
+	ActorUserID   uint      `db:"actor_user_id"`
+	SubjectUserID *uint     `db:"subject_user_id"`
+	Action        string    `db:"action"`
+	Detail        *string   `db:"detail"`
+}
+
+type Impersonation struct {
+	ID             string     `db:"id"` // the jti of the impersonation token
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at"`
+	AdminUserID    uint       `db:"admin_user_id"`
+	AdminSessionID string     `db:"admin_session_id"` // the session the admin returns to
+	UserID         uint       `db:"user_id"`
+	Reason         string     `db:"reason"`
+	AllowWrites    bool       `db:"allow_writes"`
+	ExpiresAt      time.Time  `db:"expires_at"`
+	EndedAt        *time.Time `db:"ended_at"`
+}
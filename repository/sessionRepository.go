@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"github.com/jmoiron/sqlx"
+	"lunchorder/queries"
+	"time"
+)
+
+type SessionRepository struct {
+	db *sqlx.DB
+}
+
+func NewSessionRepository(db *sqlx.DB) *SessionRepository {
+	return &SessionRepository{
+		db: db,
+	}
+}
+
+// CreateSession stores a session expiring ttl from now, measured by the database clock
+func (r *SessionRepository) CreateSession(session *Session, ttl time.Duration) error {
+	_, err := r.db.Exec(queries.CreateSession, session.ID, session.UserID, session.RefreshTokenHash, int64(ttl.Seconds()))
+	return err
+}
+
+func (r *SessionRepository) GetSessionByID(id string) (*Session, error) {
+	var session Session
+	err := r.db.Get(&session, queries.GetSessionByID, id)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSessionByRefreshToken only returns sessions that are neither revoked nor expired.
+// A token that was rotated in the last few seconds still matches, so parallel
+// requests racing to refresh the same token do not log the user out.
+func (r *SessionRepository) GetSessionByRefreshToken(refreshTokenHash string) (*Session, error) {
+	var session Session
+	err := r.db.Get(&session, queries.GetSessionByRefreshToken, refreshTokenHash, refreshTokenHash)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSessionByPreviousRefreshToken finds the unrevoked session whose refresh
+// token was rotated away from refreshTokenHash, however long ago
+func (r *SessionRepository) GetSessionByPreviousRefreshToken(refreshTokenHash string) (*Session, error) {
+	var session Session
+	err := r.db.Get(&session, queries.GetSessionByPreviousRefreshToken, refreshTokenHash)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RotateRefreshToken swaps the refresh token only if oldHash is still current,
+// so two concurrent refreshes with the same token cannot both succeed
+func (r *SessionRepository) RotateRefreshToken(id string, oldHash string, newHash string, ttl time.Duration) (bool, error) {
+	result, err := r.db.Exec(queries.RotateRefreshToken, newHash, int64(ttl.Seconds()), id, oldHash)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func (r *SessionRepository) RevokeSession(id string) error {
+	_, err := r.db.Exec(queries.RevokeSession, id)
+	return err
+}
+
+func (r *SessionRepository) RevokeUserSessions(userID uint) error {
+	_, err := r.db.Exec(queries.RevokeUserSessions, userID)
+	return err
+}
+
+func (r *SessionRepository) GetActiveUserSessions(userID uint) ([]Session, error) {
+	var sessions []Session
+	err := r.db.Select(&sessions, queries.GetActiveUserSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// GetUserSessions returns the user's sessions including revoked and expired ones
+func (r *SessionRepository) GetUserSessions(userID uint) ([]Session, error) {
+	var sessions []Session
+	err := r.db.Select(&sessions, queries.GetUserSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"lunchorder/queries"
+	"lunchorder/utils"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// userKeyCacheTTL bounds how long a user key deleted by another instance can still be used here
+const userKeyCacheTTL = 5 * time.Minute
+
+type userKeyEntry struct {
+	dek       []byte
+	fetchedAt time.Time
+}
+
+// UserKeyRepository stores every user's data-encryption key (DEK), wrapped by
+// the key provider. It is the only holder of the data keys and the provider,
+// so repositories encrypt user data through the ciphers it hands out.
+type UserKeyRepository struct {
+	db       *sqlx.DB
+	provider utils.KeyProvider
+	keys     *utils.DataKeys
+
+	mu    sync.Mutex
+	cache map[uint]userKeyEntry
+}
+
+func NewUserKeyRepository(db *sqlx.DB, keys *utils.DataKeys, provider utils.KeyProvider) *UserKeyRepository {
+	return &UserKeyRepository{
+		db:       db,
+		provider: provider,
+		keys:     keys,
+		cache:    map[uint]userKeyEntry{},
+	}
+}
+
+// NewUserKey is a DEK generated for a user that is about to be inserted
+type NewUserKey struct {
+	Cipher     *utils.UserCipher
+	wrappedKey string
+}
+
+// Cipher returns the cipher for a user's data. Users without a key get one
+// that reads and writes with the data keys alone.
+func (r *UserKeyRepository) Cipher(userID uint) (*utils.UserCipher, error) {
+	dek, err := r.getKey(userID)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewUserCipher(dek, r.keys), nil
+}
+
+// CipherForWrite returns the cipher for a user's data, creating their key first if they have none
+func (r *UserKeyRepository) CipherForWrite(userID uint) (*utils.UserCipher, error) {
+	dek, err := r.getKey(userID)
+	if err != nil {
+		return nil, err
+	}
+	if dek != nil {
+		return utils.NewUserCipher(dek, r.keys), nil
+	}
+
+	key, err := r.NewKey()
+	if err != nil {
+		return nil, err
+	}
+	// INSERT IGNORE keeps whichever key a concurrent request stored first
+	if _, err := r.db.NamedExec(queries.CreateUserKey, UserKey{UserID: userID, WrappedKey: key.wrappedKey}); err != nil {
+		return nil, err
+	}
+	return r.Cipher(userID)
+}
+
+// NewKey generates a DEK for a user that does not exist yet. Encrypt their
+// fields with its Cipher, then store it with CreateKey in the same transaction
+// as the user.
+func (r *UserKeyRepository) NewKey() (*NewUserKey, error) {
+	dek, err := utils.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := r.provider.WrapKey(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &NewUserKey{
+		Cipher:     utils.NewUserCipher(dek, r.keys),
+		wrappedKey: wrapped,
+	}, nil
+}
+
+func (r *UserKeyRepository) CreateKey(tx *sqlx.Tx, userID uint, key *NewUserKey) error {
+	_, err := tx.NamedExec(queries.CreateUserKey, UserKey{UserID: userID, WrappedKey: key.wrappedKey})
+	return err
+}
+
+// DeleteKey crypto-shreds a user: everything encrypted with their key becomes
+// unreadable. Other instances may keep using a cached copy for userKeyCacheTTL.
+func (r *UserKeyRepository) DeleteKey(tx *sqlx.Tx, userID uint) error {
+	if _, err := tx.Exec(queries.DeleteUserKey, userID); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	delete(r.cache, userID)
+	r.mu.Unlock()
+	return nil
+}
+
+// BlindIndexes returns the hashes of input under every data key, for lookups
+func (r *UserKeyRepository) BlindIndexes(index string, input string) []string {
+	return r.keys.Hashes(index, input)
+}
+
+// DataKeys returns the data keys, for tables not encrypted per user
+func (r *UserKeyRepository) DataKeys() *utils.DataKeys {
+	return r.keys
+}
+
+// getKey returns the user's unwrapped DEK, or nil if they have none
+func (r *UserKeyRepository) getKey(userID uint) ([]byte, error) {
+	r.mu.Lock()
+	entry, ok := r.cache[userID]
+	r.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < userKeyCacheTTL {
+		return entry.dek, nil
+	}
+
+	var key UserKey
+	err := r.db.Get(&key, queries.GetUserKey, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Not cached: the key may be created by another instance at any time
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dek, err := r.provider.UnwrapKey(key.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Drop stale entries so the cache cannot grow without bound
+	for id, entry := range r.cache {
+		if time.Since(entry.fetchedAt) >= userKeyCacheTTL {
+			delete(r.cache, id)
+		}
+	}
+	r.cache[userID] = userKeyEntry{dek: dek, fetchedAt: time.Now()}
+
+	return dek, nil
+}
+
+// RewrapBatch rewraps up to limit user keys with user ids above afterID with
+// the provider's current master key. Providers that can tell a current wrapped
+// key apart (the env and file keyrings) skip those; others rewrap every key.
+func (r *UserKeyRepository) RewrapBatch(afterID uint, limit int) (RotationBatch, error) {
+	batch := RotationBatch{LastID: afterID}
+
+	var keys []UserKey
+	if err := r.db.Select(&keys, queries.GetUserKeysAfter, afterID, limit); err != nil {
+		return batch, err
+	}
+
+	current, canTell := r.provider.(interface{ IsCurrent(string) bool })
+	for _, key := range keys {
+		batch.Scanned++
+		batch.LastID = key.UserID
+		if canTell && current.IsCurrent(key.WrappedKey) {
+			continue
+		}
+
+		dek, err := r.provider.UnwrapKey(key.WrappedKey)
+		if err != nil {
+			return batch, err
+		}
+		wrapped, err := r.provider.WrapKey(dek)
+		if err != nil {
+			return batch, err
+		}
+
+		result, err := r.db.Exec(queries.RewrapUserKey, wrapped, key.UserID, key.WrappedKey)
+		if err != nil {
+			return batch, err
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return batch, err
+		} else if affected > 0 {
+			batch.Rotated++
+		} else {
+			batch.Skipped++
+		}
+	}
+
+	return batch, nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"fmt"
+	"lunchorder/queries"
+	"lunchorder/utils"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type UserMergeRepository struct {
+	db             *sqlx.DB
+	userRepository *UserRepository
+	userKeys       *UserKeyRepository
+}
+
+func NewUserMergeRepository(db *sqlx.DB, userRepository *UserRepository, userKeys *UserKeyRepository) *UserMergeRepository {
+	return &UserMergeRepository{
+		db:             db,
+		userRepository: userRepository,
+		userKeys:       userKeys,
+	}
+}
+
+// MergeUsers folds source into target in one transaction. Donations given and
+// received and donation requests are moved to target, as are source's sign-in
+// identities, re-encrypted with target's key. Profile fields target lacks,
+// such as a Google ID, are copied over so source's logins now reach target.
+// Source is then anonymised, and the merge is recorded in user_merges.
+func (r *UserMergeRepository) MergeUsers(source *User, target *User, mergedByUserID uint) (*UserMerge, error) {
+	identities, err := r.userRepository.GetUserIdentities(source.ID)
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := r.userKeys.CipherForWrite(target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	profileChanged := false
+	for _, field := range []struct{ from, to **string }{
+		{&source.Email, &target.Email},
+		{&source.GoogleID, &target.GoogleID},
+		{&source.FirstName, &target.FirstName},
+		{&source.LastName, &target.LastName},
+		{&source.AvatarURL, &target.AvatarURL},
+	} {
+		if (*field.to == nil || **field.to == "") && *field.from != nil && **field.from != "" {
+			*field.to = *field.from
+			profileChanged = true
+		}
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	merge := UserMerge{
+		SourceUserID:    source.ID,
+		TargetUserID:    target.ID,
+		MergedByUserID:  mergedByUserID,
+		IdentitiesMoved: uint(len(identities)),
+	}
+
+	for _, move := range []struct {
+		query string
+		count *uint
+	}{
+		{queries.ReassignDonor, &merge.DonationsMoved},
+		{queries.ReassignRecipient, &merge.ReceivedMoved},
+		{queries.ReassignRequester, &merge.RequestsMoved},
+	} {
+		result, err := tx.Exec(move.query, target.ID, source.ID)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		*move.count = uint(rows)
+	}
+
+	for _, identity := range identities {
+		identity.UserID = target.ID
+		if err := utils.SealFields(cipher, "user_identities", &identity); err != nil {
+			return nil, err
+		}
+		if _, err := tx.NamedExec(queries.ReassignUserIdentity, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	anonymised, err := r.userRepository.anonymiseUser(tx, source.ID, fmt.Sprintf("Merged user %d", source.ID))
+	if err != nil {
+		return nil, err
+	}
+	if !anonymised {
+		return nil, fmt.Errorf("user %d was deleted during the merge", source.ID)
+	}
+
+	if profileChanged {
+		if err := utils.SealFields(cipher, "users", target); err != nil {
+			return nil, err
+		}
+		if _, err := tx.NamedExec(queries.UpdateUserGoogle, target); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := tx.NamedExec(queries.CreateUserMerge, merge)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	merge.ID = uint(id)
+	merge.CreatedAt = time.Now()
+	merge.UpdatedAt = merge.CreatedAt
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &merge, nil
+}
+
+func (r *UserMergeRepository) GetUserMerges() ([]UserMerge, error) {
+	var merges []UserMerge
+	err := r.db.Select(&merges, queries.GetUserMerges)
+	if err != nil {
+		return nil, err
+	}
+	return merges, nil
+}
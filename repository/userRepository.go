@@ -1,89 +1,83 @@
 package repository
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
-	"log"
 	"lunchorder/queries"
 	"lunchorder/utils"
+	"regexp"
+	"strings"
 )
 
 type UserRepository struct {
-	db            *sqlx.DB
-	encryptionKey []byte
+	db       *sqlx.DB
+	userKeys *UserKeyRepository
 }
 
 var userRepo *UserRepository
 
-func NewUserRepository(db *sqlx.DB) *UserRepository {
-	key, err := utils.GetEncryptionKey()
-	if err != nil {
-		log.Fatal(err)
-	}
+func NewUserRepository(db *sqlx.DB, userKeys *UserKeyRepository) *UserRepository {
 	return &UserRepository{
-		db:            db,
-		encryptionKey: key,
+		db:       db,
+		userKeys: userKeys,
 	}
 }
 
+// prepareUserForSave encrypts the personal fields of an existing user with
+// their own key, see the encrypt tags on User
 func (r *UserRepository) prepareUserForSave(user *User) error {
-	if user.Email != nil {
-		enc, err := utils.Encrypt(*user.Email, r.encryptionKey)
-		if err != nil {
-			return err
-		}
-		user.EmailEncrypted = &enc
-
-		hash := utils.Hash(*user.Email, r.encryptionKey)
-		user.EmailHash = &hash
+	cipher, err := r.userKeys.CipherForWrite(user.ID)
+	if err != nil {
+		return err
 	}
-	if user.GoogleID != nil {
-		enc, err := utils.Encrypt(*user.GoogleID, r.encryptionKey)
-		if err != nil {
-			return err
-		}
-		user.GoogleIDEncrypted = &enc
+	return utils.SealFields(cipher, "users", user)
+}
 
-		hash := utils.Hash(*user.GoogleID, r.encryptionKey)
-		user.GoogleIDHash = &hash
+func (r *UserRepository) decryptUser(user *User) error {
+	cipher, err := r.userKeys.Cipher(user.ID)
+	if err != nil {
+		return err
 	}
-	return nil
+	return utils.OpenFields(cipher, user)
 }
 
-func (r *UserRepository) decryptUser(user *User) error {
-	if user.EmailEncrypted != nil {
-		dec, err := utils.Decrypt(*user.EmailEncrypted, r.encryptionKey)
-		if err != nil {
-			return err
-		}
-		user.Email = &dec
+// insertUser inserts a new user together with their key and returns the cipher for their data
+func (r *UserRepository) insertUser(tx *sqlx.Tx, user *User) (*utils.UserCipher, error) {
+	handle, err := r.uniqueHandle(user.Name)
+	if err != nil {
+		return nil, err
 	}
-	if user.GoogleIDEncrypted != nil {
-		dec, err := utils.Decrypt(*user.GoogleIDEncrypted, r.encryptionKey)
-		if err != nil {
-			return err
-		}
-		user.GoogleID = &dec
+	user.Handle = handle
+
+	key, err := r.userKeys.NewKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.SealFields(key.Cipher, "users", user); err != nil {
+		return nil, err
 	}
-	return nil
-}
 
-func (r *UserRepository) CreateUser(user *User) error {
-	result, err := r.db.Exec(queries.CreateUser, user.Name)
+	result, err := tx.NamedExec(queries.InsertUserGoogle, user)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	id, err := result.LastInsertId()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	user.ID = uint(id)
-	return nil
+
+	if err := r.userKeys.CreateKey(tx, user.ID, key); err != nil {
+		return nil, err
+	}
+	return key.Cipher, nil
 }
 
-func (r *UserRepository) GetUserByName(name string) (*User, error) {
+func (r *UserRepository) GetUserByHandle(handle string) (*User, error) {
 	var user User
-	err := r.db.Get(&user, queries.GetUserByName, name)
+	err := r.db.Get(&user, queries.GetUserByHandle, handle)
 	if err != nil {
 		return nil, err
 	}
@@ -95,8 +89,7 @@ func (r *UserRepository) GetUserByName(name string) (*User, error) {
 
 func (r *UserRepository) GetUserByGoogleID(googleID string) (*User, error) {
 	var user User
-	hash := utils.Hash(googleID, r.encryptionKey)
-	err := r.db.Get(&user, queries.GetUserByGoogleID, hash)
+	err := getByBlindIndex(r.db, &user, queries.GetUserByGoogleID, r.userKeys.BlindIndexes(userGoogleIDIndex, googleID))
 	if err != nil {
 		return nil, err
 	}
@@ -120,8 +113,7 @@ func (r *UserRepository) GetUserByID(id uint) (*User, error) {
 
 func (r *UserRepository) GetUserByEmail(email string) (*User, error) {
 	var user User
-	hash := utils.Hash(email, r.encryptionKey)
-	err := r.db.Get(&user, queries.GetUserByEmail, hash)
+	err := getByBlindIndex(r.db, &user, queries.GetUserByEmail, r.userKeys.BlindIndexes(userEmailIndex, email))
 	if err != nil {
 		return nil, err
 	}
@@ -131,42 +123,177 @@ func (r *UserRepository) GetUserByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-func (r *UserRepository) UpsertUser(user *User) error {
-	// Prepare encryption fields
+func (r *UserRepository) GetUsers() ([]User, error) {
+	var users []User
+	err := r.db.Select(&users, queries.GetUsers)
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		if err := r.decryptUser(&users[i]); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// GetUsersPage returns limit users that have not been deleted, skipping the
+// first offset in id order. Only the page is decrypted.
+func (r *UserRepository) GetUsersPage(offset int, limit int) ([]User, error) {
+	var users []User
+	err := r.db.Select(&users, queries.GetUsersPage, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		if err := r.decryptUser(&users[i]); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// CountUsers counts the users that have not been deleted
+func (r *UserRepository) CountUsers() (int, error) {
+	var count int
+	err := r.db.Get(&count, queries.CountUsers)
+	return count, err
+}
+
+// UpdateUserPreferences saves the display name and preferences the user edits
+// themselves
+func (r *UserRepository) UpdateUserPreferences(user *User) error {
 	if err := r.prepareUserForSave(user); err != nil {
 		return err
 	}
+	_, err := r.db.NamedExec(queries.UpdateUserPreferences, user)
+	return err
+}
+
+// CreateUser inserts a user that has not signed in yet, such as one
+// provisioned through SCIM. They are linked to their login on first sign-in
+// by email.
+func (r *UserRepository) CreateUser(user *User) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := r.insertUser(tx, user); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetUserActive activates or deactivates a user. Deactivating also revokes
+// their API tokens, cancels their pending requests and withdraws the
+// donations they offered for today or later that nobody has claimed yet.
+func (r *UserRepository) SetUserActive(id uint, active bool) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
+	if _, err := tx.Exec(queries.UpdateUserActive, active, id); err != nil {
+		return err
+	}
+
+	if !active {
+		for _, query := range []string{queries.RevokeUserApiTokens, queries.CancelUserRequests, queries.DeleteUnclaimedDonationsByDonor} {
+			if _, err := tx.Exec(query, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *UserRepository) SetNameVisibility(id uint, visibility string) error {
+	_, err := r.db.Exec(queries.UpdateUserPrivacy, visibility, id)
+	return err
+}
+
+func (r *UserRepository) SetUserAdmin(id uint, isAdmin bool) error {
+	_, err := r.db.Exec(queries.UpdateUserAdmin, isAdmin, id)
+	return err
+}
+
+// GetUserIdentities returns the external sign-in identities linked to the user
+func (r *UserRepository) GetUserIdentities(userID uint) ([]UserIdentity, error) {
+	var identities []UserIdentity
+	err := r.db.Select(&identities, queries.GetUserIdentitiesByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher, err := r.userKeys.Cipher(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range identities {
+		if err := utils.OpenFields(cipher, &identities[i]); err != nil {
+			return nil, err
+		}
+	}
+	return identities, nil
+}
+
+// AnonymiseUser erases a user's personal data but keeps the row, so their
+// donations still count towards the totals. Their name is replaced, personal
+// columns are cleared, identities are unlinked and their key is deleted,
+// which also shreds any copy of their data left in backups. Their API tokens
+// are revoked, pending requests cancelled and the donations they offered for
+// today or later that nobody has claimed yet withdrawn. Returns false if the
+// user does not exist or was already anonymised.
+func (r *UserRepository) AnonymiseUser(id uint) (bool, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	anonymised, err := r.anonymiseUser(tx, id, fmt.Sprintf("Deleted user %d", id))
+	if err != nil || !anonymised {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (r *UserRepository) anonymiseUser(tx *sqlx.Tx, id uint, name string) (bool, error) {
+	result, err := tx.Exec(queries.AnonymiseUser, name, id)
+	if err != nil {
+		return false, err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return false, err
+	}
+
+	for _, query := range []string{queries.DeleteUserIdentities, queries.RevokeUserApiTokens, queries.CancelUserRequests, queries.DeleteUnclaimedDonationsByDonor} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return false, err
+		}
+	}
+	if err := r.userKeys.DeleteKey(tx, id); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *UserRepository) UpsertUser(user *User) error {
 	// 1. Check if user exists by Google ID
 	existingUser, err := r.GetUserByGoogleID(*user.GoogleID)
 	if err == nil {
 		// User exists, update
 		user.ID = existingUser.ID
 
-		// Check for name conflict if name changed
-		if user.Name != existingUser.Name {
-			// Check if new name is taken
-			otherUser, err := r.GetUserByName(user.Name)
-			if err == nil && otherUser.ID != user.ID {
-				// Name taken by someone else. Append suffix.
-				originalName := user.Name
-				for i := 1; i <= 10; i++ {
-					newName := fmt.Sprintf("%s%d", originalName, i)
-					u, err := r.GetUserByName(newName)
-					if err != nil {
-						// Name is free (assuming err is not found)
-						user.Name = newName
-						break
-					}
-					if u.ID == user.ID {
-						// We already own this name
-						user.Name = newName
-						break
-					}
-				}
-			}
+		if err := r.prepareUserForSave(user); err != nil {
+			return err
 		}
-
 		_, err = r.db.NamedExec(queries.UpdateUserGoogle, user)
 		return err
 	}
@@ -178,64 +305,133 @@ func (r *UserRepository) UpsertUser(user *User) error {
 			// User exists by email, update with Google ID
 			user.ID = existingUser.ID
 
-			// Check for name conflict if name changed
-			if user.Name != existingUser.Name {
-				// Check if new name is taken
-				otherUser, err := r.GetUserByName(user.Name)
-				if err == nil && otherUser.ID != user.ID {
-					// Name taken by someone else. Append suffix.
-					originalName := user.Name
-					for i := 1; i <= 10; i++ {
-						newName := fmt.Sprintf("%s%d", originalName, i)
-						u, err := r.GetUserByName(newName)
-						if err != nil {
-							// Name is free (assuming err is not found)
-							user.Name = newName
-							break
-						}
-						if u.ID == user.ID {
-							// We already own this name
-							user.Name = newName
-							break
-						}
-					}
-				}
+			if err := r.prepareUserForSave(user); err != nil {
+				return err
 			}
-
 			_, err = r.db.NamedExec(queries.UpdateUserGoogle, user)
 			return err
 		}
 	}
 
 	// 3. User does not exist, insert
-	originalName := user.Name
-	for i := 0; i <= 10; i++ {
-		if i > 0 {
-			user.Name = fmt.Sprintf("%s%d", originalName, i)
-		}
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := r.insertUser(tx, user); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpsertUserWithIdentity signs in a user from an external OIDC issuer. The
+// issuer-qualified subject is stored encrypted with a blind index, the same
+// way google_id is, so a returning user is found without decrypting anything.
+// New identities are linked to an existing user with the same email only if
+// the issuer verified that email, otherwise anyone able to put an address in
+// their token could take over that account.
+func (r *UserRepository) UpsertUserWithIdentity(user *User, provider string, issuer string, subject string, emailVerified bool) error {
+	subjectKey := issuer + "|" + subject
 
-		existing, err := r.GetUserByName(user.Name)
-		if err == nil && existing != nil {
-			// Name taken, try next
-			continue
+	// 1. Check if the identity is already linked
+	var identity UserIdentity
+	err := getByBlindIndex(r.db, &identity, queries.GetUserIdentityBySubject, r.userKeys.BlindIndexes(userIdentitySubjectIndex, subjectKey))
+	if err == nil {
+		return r.updateUserProfile(user, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// The subject is personal data too, so it is encrypted with the user's key
+	identity = UserIdentity{
+		Provider: provider,
+		Subject:  subjectKey,
+	}
+
+	// 2. Link to an existing user with the same verified email
+	if emailVerified && user.Email != nil && *user.Email != "" {
+		existingUser, err := r.GetUserByEmail(*user.Email)
+		if err == nil {
+			cipher, err := r.userKeys.CipherForWrite(existingUser.ID)
+			if err != nil {
+				return err
+			}
+			if err := utils.SealFields(cipher, "user_identities", &identity); err != nil {
+				return err
+			}
+			identity.UserID = existingUser.ID
+			if _, err := r.db.NamedExec(queries.CreateUserIdentity, identity); err != nil {
+				return err
+			}
+			return r.updateUserProfile(user, existingUser.ID)
 		}
+	}
 
-		// Name free (or DB error), try insert
-		_, err = r.db.NamedExec(queries.InsertUserGoogle, user)
-		if err != nil {
-			// If it's a duplicate entry error (race condition), we might want to retry loop?
-			// But for now, return error if insert fails
-			return err
+	// 3. Create a new user and link the identity
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	cipher, err := r.insertUser(tx, user)
+	if err != nil {
+		return err
+	}
+	if err := utils.SealFields(cipher, "user_identities", &identity); err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+	if _, err := tx.NamedExec(queries.CreateUserIdentity, identity); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *UserRepository) updateUserProfile(user *User, id uint) error {
+	user.ID = id
+
+	if err := r.prepareUserForSave(user); err != nil {
+		return err
+	}
+	_, err := r.db.NamedExec(queries.UpdateUserProfile, user)
+	return err
+}
+
+// handleSeparators matches everything a handle is not made of
+var handleSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// uniqueHandle derives a handle for a new user from their name: lowercase
+// letters and digits joined by dashes, with the first free "_<n>" suffix if
+// it is taken. Handles never change afterwards, whatever the name becomes.
+func (r *UserRepository) uniqueHandle(name string) (string, error) {
+	base := strings.Trim(handleSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(base) > 48 {
+		base = strings.TrimRight(base[:48], "-")
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s_%d", base, i)
 		}
 
-		// Success
-		updatedUser, err := r.GetUserByGoogleID(*user.GoogleID)
+		_, err := r.GetUserByHandle(candidate)
+		if errors.Is(err, sql.ErrNoRows) {
+			return candidate, nil
+		}
 		if err != nil {
-			return err
+			return "", err
 		}
-		user.ID = updatedUser.ID
-		return nil
 	}
 
-	return fmt.Errorf("failed to find unique name for user")
-}
\ No newline at end of file
+	return "", fmt.Errorf("failed to find unique handle for user")
+}
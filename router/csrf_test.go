@@ -0,0 +1,59 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(CSRFMiddleware([]string{"http://localhost:5173/"}))
+	r.Any("/Api/Donation", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    int
+	}{
+		{name: "safe method cross-site", method: http.MethodGet, headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example.com"}, want: http.StatusOK},
+		{name: "same origin", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "same-origin"}, want: http.StatusOK},
+		{name: "typed into the address bar", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "none"}, want: http.StatusOK},
+		{name: "cross-site", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "cross-site"}, want: http.StatusForbidden},
+		{name: "cross-site with a trusted origin", method: http.MethodDelete, headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "http://localhost:5173"}, want: http.StatusForbidden},
+		{name: "same-site from a trusted origin", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "http://localhost:5173"}, want: http.StatusOK},
+		{name: "same-site from another origin", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "http://localhost:3000"}, want: http.StatusForbidden},
+		{name: "same-site without origin or referer", method: http.MethodPost, headers: map[string]string{"Sec-Fetch-Site": "same-site"}, want: http.StatusForbidden},
+		{name: "no fetch metadata, own origin", method: http.MethodPut, headers: map[string]string{"Origin": "http://lunch.example.com"}, want: http.StatusOK},
+		{name: "no fetch metadata, own origin behind tls proxy", method: http.MethodPut, headers: map[string]string{"Origin": "https://lunch.example.com", "X-Forwarded-Proto": "https"}, want: http.StatusOK},
+		{name: "no fetch metadata, scheme downgrade", method: http.MethodPut, headers: map[string]string{"Origin": "https://lunch.example.com"}, want: http.StatusForbidden},
+		{name: "no fetch metadata, foreign origin", method: http.MethodPost, headers: map[string]string{"Origin": "https://evil.example.com"}, want: http.StatusForbidden},
+		{name: "no fetch metadata, null origin with foreign referer", method: http.MethodPost, headers: map[string]string{"Origin": "null", "Referer": "https://evil.example.com/form"}, want: http.StatusForbidden},
+		{name: "no fetch metadata, trusted referer", method: http.MethodPost, headers: map[string]string{"Referer": "http://localhost:5173/give"}, want: http.StatusOK},
+		{name: "non-browser client", method: http.MethodPost, want: http.StatusOK},
+		{name: "bearer token", method: http.MethodPost, headers: map[string]string{"Authorization": "Bearer lo_token", "Sec-Fetch-Site": "cross-site"}, want: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, "http://lunch.example.com/Api/Donation", nil)
+			for name, value := range test.headers {
+				request.Header.Set(name, value)
+			}
+
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.want {
+				t.Errorf("expected %d, got %d", test.want, recorder.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package router
+
+import (
+	"log/slog"
+	"lunchorder/logging"
+	"lunchorder/repository"
+	"lunchorder/utils"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID accepts ids set by a proxy in front of us, but nothing that
+// could forge log lines
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestIDMiddleware gives every request an id, reusing the caller's
+// X-Request-ID when it sent a sane one. The id is echoed back in the response
+// and carried in the request context, so everything logged for the request
+// down to the repositories can be found by it.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID, _ = utils.RandomToken(12)
+		}
+
+		c.Header(requestIDHeader, requestID)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestID))
+		c.Next()
+	}
+}
+
+// AccessLogMiddleware logs one line per request. It logs the route pattern
+// rather than the path, and never the query string, which may name users.
+func AccessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		}
+		if user, ok := c.Get("user"); ok {
+			if user, ok := user.(*repository.User); ok {
+				attrs = append(attrs, slog.Uint64("user_id", uint64(user.ID)))
+			}
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
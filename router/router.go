@@ -1,60 +1,142 @@
 package router
 
 import (
+	"lunchorder/auth"
 	"lunchorder/handlers"
 	"lunchorder/repository"
+	"lunchorder/service"
 	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(r *gin.Engine, mealHandler *handlers.MealHandler, donationHandler *handlers.DonationHandler, donationRequestHandler *handlers.DonationRequestHandler, authHandler *handlers.AuthHandler, userRepo *repository.UserRepository) {
+func SetupRoutes(r *gin.Engine, mealHandler *handlers.MealHandler, donationHandler *handlers.DonationHandler, donationRequestHandler *handlers.DonationRequestHandler, authHandler *handlers.AuthHandler, emailAccessHandler *handlers.EmailAccessHandler, apiTokenHandler *handlers.ApiTokenHandler, privacyHandler *handlers.PrivacyHandler, userHandler *handlers.UserHandler, impersonationHandler *handlers.ImpersonationHandler, auditHandler *handlers.AuditHandler, userRepo *repository.UserRepository, sessionService *service.SessionService, apiTokenService *service.ApiTokenService, impersonationService *service.ImpersonationService, keyring *auth.Keyring, cookies handlers.CookieSettings) {
 	// Auth routes
-	r.GET("/auth/google/login", authHandler.GoogleLogin)
-	r.GET("/auth/google/callback", authHandler.GoogleCallback)
+	r.GET("/auth/providers", authHandler.GetProviders)
+	r.GET("/auth/jwks.json", authHandler.GetJWKS)
+	r.GET("/auth/:provider/login", authHandler.Login)
+	r.GET("/auth/:provider/callback", authHandler.Callback)
+	r.POST("/auth/refresh", authHandler.Refresh)
 	r.POST("/auth/logout", authHandler.Logout)
 
-	// Protected routes
+	// Protected routes. Every route declares the scope a personal access token
+	// needs to call it; an empty scope means browser sessions only.
+	scope := handlers.RequireScope
+	sessionOnly := handlers.RequireScope("")
+
 	api := r.Group("/Api")
-	api.Use(handlers.AuthMiddleware(userRepo))
+	api.Use(handlers.AuthMiddleware(userRepo, sessionService, apiTokenService, impersonationService, keyring, cookies))
 	{
-		api.GET("/Me", authHandler.GetMe)
+		api.GET("/Me", scope(service.ScopeProfileRead), userHandler.HandleGetMe)
+		api.PUT("/Me", sessionOnly, userHandler.HandleUpdateMe)
+		// Also reachable while impersonating, which closes all session-only routes
+		api.DELETE("/Me/Impersonation", scope(service.ScopeProfileRead), impersonationHandler.HandleEndImpersonation)
+
+		api.GET("/Me/Sessions", sessionOnly, authHandler.GetMySessions)
+		api.POST("/Me/Sessions/Revoke", sessionOnly, authHandler.LogoutEverywhere)
+
+		api.GET("/Me/Tokens", sessionOnly, apiTokenHandler.HandleGetApiTokens)
+		api.POST("/Me/Tokens", sessionOnly, apiTokenHandler.HandleCreateApiToken)
+		api.DELETE("/Me/Tokens/:id", sessionOnly, apiTokenHandler.HandleRevokeApiToken)
+
+		api.GET("/Me/Export", sessionOnly, privacyHandler.HandleExportMe)
+		api.DELETE("/Me", sessionOnly, privacyHandler.HandleEraseMe)
+		api.GET("/Me/Privacy", scope(service.ScopeProfileRead), privacyHandler.HandleGetPrivacySettings)
+		api.PUT("/Me/Privacy", sessionOnly, privacyHandler.HandleUpdatePrivacySettings)
+
+		// Without ?userId= these return the caller's own claim and requests;
+		// only admins may name another user
+		api.GET("/Me/Donation/Claim", scope(service.ScopeDonationsRead), donationHandler.HandleGetDonationClaim)
+		api.GET("/Me/DonationRequests", scope(service.ScopeRequestsRead), donationRequestHandler.HandleGetUserDonationRequests)
 
-		api.GET("/Meal", mealHandler.HandleGetMeals)
-		api.GET("/Meal/Today", mealHandler.HandleGetMealsToday)
+		api.GET("/Meal", scope(service.ScopeMealsRead), mealHandler.HandleGetMeals)
+		api.GET("/Meal/Today", scope(service.ScopeMealsRead), mealHandler.HandleGetMealsToday)
 
-		api.POST("/Donation", donationHandler.HandleDonateMeal)
-		api.GET("/Donation", donationHandler.HandleGetUnclaimedDonations)
+		api.POST("/Donation", scope(service.ScopeDonationsWrite), donationHandler.HandleDonateMeal)
+		api.GET("/Donation", scope(service.ScopeDonationsRead), donationHandler.HandleGetUnclaimedDonations)
 
-		api.POST("/Donation/Claim", donationHandler.HandleDonationClaim)
-		api.GET("/Donation/Claim", donationHandler.HandleGetDonationClaim)
+		api.POST("/Donation/Claim", scope(service.ScopeDonationsWrite), donationHandler.HandleDonationClaim)
+		api.GET("/Donation/Claim", scope(service.ScopeDonationsRead), donationHandler.HandleGetDonationClaim)
+		api.GET("/Donation/Claim/QR", scope(service.ScopeDonationsRead), donationHandler.HandleGetDonationClaimQR)
 
 		// Donation request routes
-		api.POST("/DonationRequest", donationRequestHandler.HandleCreateDonationRequest)
-		api.GET("/DonationRequest", donationRequestHandler.HandleGetPendingDonationRequests)
-		api.GET("/DonationRequest/User", donationRequestHandler.HandleGetUserDonationRequests)
+		api.POST("/DonationRequest", scope(service.ScopeRequestsWrite), donationRequestHandler.HandleCreateDonationRequest)
+		api.GET("/DonationRequest", scope(service.ScopeRequestsRead), donationRequestHandler.HandleGetPendingDonationRequests)
+		api.GET("/DonationRequest/User", scope(service.ScopeRequestsRead), donationRequestHandler.HandleGetUserDonationRequests)
 
 		// Admin routes
 		admin := api.Group("/")
-		admin.Use(handlers.AdminMiddleware())
+		admin.Use(handlers.AdminMiddleware(), scope(service.ScopeAdmin))
 		{
 			admin.POST("/Meal/Upload", mealHandler.HandleMealUpload)
 			admin.GET("/Stats/Claims/Summary", donationHandler.HandleGetDonationSummary)
+			admin.POST("/Donation/Collect", donationHandler.HandleCollectDonation)
+
+			admin.GET("/EmailAccess", emailAccessHandler.HandleGetEmailAccessRules)
+			admin.POST("/EmailAccess", emailAccessHandler.HandleSetEmailAccessRule)
+			admin.DELETE("/EmailAccess/:id", emailAccessHandler.HandleDeleteEmailAccessRule)
+
+			admin.GET("/Users", userHandler.HandleGetUsers)
+			admin.PUT("/Users/:id/Active", userHandler.HandleSetUserActive)
+			admin.POST("/Users/:id/Sessions/Revoke", authHandler.RevokeUserSessions)
+			admin.GET("/Users/:id/Export", privacyHandler.HandleExportUser)
+			admin.DELETE("/Users/:id", privacyHandler.HandleEraseUser)
+
+			admin.POST("/Users/Merge", userHandler.HandleMergeUsers)
+			admin.GET("/Users/Merges", userHandler.HandleGetUserMerges)
+
+			admin.POST("/Users/:id/Impersonate", sessionOnly, impersonationHandler.HandleStartImpersonation)
+			admin.GET("/Audit", auditHandler.HandleGetAuditLog)
 		}
 	}
 }
 
-func SetupCors(r *gin.Engine) {
+// SetupHealthRoutes registers the liveness and readiness probes. They sit
+// outside /Api, so they need no authentication.
+func SetupHealthRoutes(r *gin.Engine, healthHandler *handlers.HealthHandler) {
+	r.GET("/healthz", healthHandler.HandleHealthz)
+	r.GET("/readyz", healthHandler.HandleReadyz)
+}
+
+// SetupDevRoutes registers the offline login used for local development only
+func SetupDevRoutes(r *gin.Engine, devAuthHandler *handlers.DevAuthHandler) {
+	r.GET("/auth/dev/login", devAuthHandler.HandleDevLoginPage)
+	r.POST("/auth/dev/login", devAuthHandler.HandleDevLogin)
+}
+
+// SetupScimRoutes registers SCIM 2.0 user provisioning for the identity
+// provider, authenticated by its own bearer token rather than a user's
+func SetupScimRoutes(r *gin.Engine, scimHandler *handlers.ScimHandler, token string) {
+	scim := r.Group("/scim/v2")
+	scim.Use(handlers.ScimAuthMiddleware(token))
+	{
+		scim.GET("/Users", scimHandler.HandleGetUsers)
+		scim.POST("/Users", scimHandler.HandleCreateUser)
+		scim.GET("/Users/:id", scimHandler.HandleGetUser)
+		scim.PATCH("/Users/:id", scimHandler.HandlePatchUser)
+		scim.DELETE("/Users/:id", scimHandler.HandleDeleteUser)
+	}
+}
+
+// SetupCors lets allowedOrigins call the API from the browser in addition to the app's own origin
+func SetupCors(r *gin.Engine, allowedOrigins []string) {
+	if len(allowedOrigins) == 0 {
+		return
+	}
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173"},
+		AllowOrigins:     allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 	}))
 }
 
+func SetupCsrf(r *gin.Engine, allowedOrigins []string) {
+	r.Use(CSRFMiddleware(allowedOrigins))
+}
+
 func SetupFrontEnd(r *gin.Engine) {
 	r.Static("/assets", "./frontend/dist/assets")
 	r.StaticFile("/vite.svg", "./frontend/dist/vite.svg")
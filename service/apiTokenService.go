@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"lunchorder/models"
+	"lunchorder/repository"
+	"lunchorder/utils"
+	"sort"
+	"strings"
+)
+
+// ApiTokenPrefix marks personal access tokens so they are easy to spot in logs and secret scanners
+const ApiTokenPrefix = "lop_"
+
+const (
+	ScopeProfileRead    = "profile:read"
+	ScopeMealsRead      = "meals:read"
+	ScopeDonationsRead  = "donations:read"
+	ScopeDonationsWrite = "donations:write"
+	ScopeRequestsRead   = "requests:read"
+	ScopeRequestsWrite  = "requests:write"
+	ScopeAdmin          = "admin"
+)
+
+var ApiTokenScopes = []string{
+	ScopeProfileRead,
+	ScopeMealsRead,
+	ScopeDonationsRead,
+	ScopeDonationsWrite,
+	ScopeRequestsRead,
+	ScopeRequestsWrite,
+	ScopeAdmin,
+}
+
+const maxApiTokenExpiryDays = 365
+
+var ErrInvalidApiToken = errors.New("invalid or expired api token")
+var ErrApiTokenNotFound = errors.New("api token not found")
+var ErrInvalidApiTokenRequest = errors.New("name and at least one known scope are required")
+var ErrInvalidApiTokenExpiry = errors.New("expiresInDays must be between 0 and 365")
+
+type ApiTokenService struct {
+	apiTokenRepository *repository.ApiTokenRepository
+}
+
+func NewApiTokenService(apiTokenRepository *repository.ApiTokenRepository) *ApiTokenService {
+	return &ApiTokenService{
+		apiTokenRepository: apiTokenRepository,
+	}
+}
+
+// CreateApiToken issues a new token. The plaintext is only ever returned here; only its hash is stored.
+func (s *ApiTokenService) CreateApiToken(userID uint, request *models.ApiTokenCreateRequest) (models.ApiTokenCreatedResponse, error) {
+	name := strings.TrimSpace(request.Name)
+	scopes, ok := normalizeScopes(request.Scopes)
+	if name == "" || !ok {
+		return models.ApiTokenCreatedResponse{}, ErrInvalidApiTokenRequest
+	}
+
+	if request.ExpiresInDays < 0 || request.ExpiresInDays > maxApiTokenExpiryDays {
+		return models.ApiTokenCreatedResponse{}, ErrInvalidApiTokenExpiry
+	}
+
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		return models.ApiTokenCreatedResponse{}, err
+	}
+	plaintext := ApiTokenPrefix + secret
+
+	token := &repository.ApiToken{
+		UserID:      userID,
+		Name:        name,
+		TokenPrefix: plaintext[:len(ApiTokenPrefix)+6],
+		TokenHash:   utils.HashToken(plaintext),
+		Scopes:      strings.Join(scopes, ","),
+	}
+	if err := s.apiTokenRepository.CreateApiToken(token, request.ExpiresInDays); err != nil {
+		return models.ApiTokenCreatedResponse{}, err
+	}
+
+	return models.ApiTokenCreatedResponse{
+		ID:     token.ID,
+		Name:   token.Name,
+		Token:  plaintext,
+		Scopes: scopes,
+	}, nil
+}
+
+// Authenticate resolves a bearer token to its stored record and scopes
+func (s *ApiTokenService) Authenticate(ctx context.Context, plaintext string) (*repository.ApiToken, []string, error) {
+	if !strings.HasPrefix(plaintext, ApiTokenPrefix) {
+		return nil, nil, ErrInvalidApiToken
+	}
+
+	token, err := s.apiTokenRepository.GetActiveApiTokenByHash(utils.HashToken(plaintext))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrInvalidApiToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.apiTokenRepository.TouchApiToken(ctx, token.ID); err != nil {
+		slog.WarnContext(ctx, "Failed to record api token use", "api_token_id", token.ID, "error", err)
+	}
+
+	return token, strings.Split(token.Scopes, ","), nil
+}
+
+func (s *ApiTokenService) GetApiTokens(userID uint) ([]models.ApiTokenResponse, error) {
+	tokens, err := s.apiTokenRepository.GetApiTokensByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := []models.ApiTokenResponse{}
+	for _, token := range tokens {
+		response = append(response, models.ApiTokenResponse{
+			ID:          token.ID,
+			Name:        token.Name,
+			TokenPrefix: token.TokenPrefix,
+			Scopes:      strings.Split(token.Scopes, ","),
+			CreatedAt:   token.CreatedAt,
+			ExpiresAt:   token.ExpiresAt,
+			LastUsedAt:  token.LastUsedAt,
+		})
+	}
+
+	return response, nil
+}
+
+func (s *ApiTokenService) RevokeApiToken(id uint, userID uint) error {
+	revoked, err := s.apiTokenRepository.RevokeApiToken(id, userID)
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return ErrApiTokenNotFound
+	}
+
+	return nil
+}
+
+// normalizeScopes dedupes and sorts scopes, failing on unknown ones
+func normalizeScopes(scopes []string) ([]string, bool) {
+	seen := map[string]bool{}
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		known := false
+		for _, allowed := range ApiTokenScopes {
+			if scope == allowed {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, false
+		}
+		seen[scope] = true
+	}
+
+	var result []string
+	for scope := range seen {
+		result = append(result, scope)
+	}
+	sort.Strings(result)
+
+	return result, len(result) > 0
+}
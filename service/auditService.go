@@ -0,0 +1,57 @@
+package service
+
+import (
+	"lunchorder/models"
+	"lunchorder/repository"
+)
+
+// Audit log actions
+const (
+	AuditImpersonationStart   = "impersonation.start"
+	AuditImpersonationEnd     = "impersonation.end"
+	AuditImpersonationRequest = "impersonation.request"
+)
+
+type AuditService struct {
+	auditRepository *repository.AuditRepository
+}
+
+func NewAuditService(auditRepository *repository.AuditRepository) *AuditService {
+	return &AuditService{auditRepository: auditRepository}
+}
+
+// Record appends an entry to the audit log. subjectID is the user the action
+// was taken on, or 0 if there is none.
+func (s *AuditService) Record(actorID uint, subjectID uint, action string, detail string) error {
+	entry := repository.AuditEntry{
+		ActorUserID: actorID,
+		Action:      action,
+	}
+	if subjectID != 0 {
+		entry.SubjectUserID = &subjectID
+	}
+	if detail != "" {
+		entry.Detail = &detail
+	}
+	return s.auditRepository.CreateAuditEntry(&entry)
+}
+
+func (s *AuditService) GetAuditLog(limit int) ([]models.AuditEntryResponse, error) {
+	entries, err := s.auditRepository.GetAuditLog(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	response := []models.AuditEntryResponse{}
+	for _, entry := range entries {
+		response = append(response, models.AuditEntryResponse{
+			ID:            entry.ID,
+			CreatedAt:     entry.CreatedAt,
+			ActorUserID:   entry.ActorUserID,
+			SubjectUserID: entry.SubjectUserID,
+			Action:        entry.Action,
+			Detail:        entry.Detail,
+		})
+	}
+	return response, nil
+}
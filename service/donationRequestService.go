@@ -3,8 +3,11 @@ package service
 import (
 	"database/sql"
 	"errors"
+	"lunchorder/metrics"
 	"lunchorder/models"
 	"lunchorder/repository"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type DonationRequestService struct {
@@ -28,21 +31,21 @@ func NewDonationRequestService(
 }
 
 func (s *DonationRequestService) CreateDonationRequest(request *models.DonationRequestCreate) error {
-	// Get or create user
-	user, err := s.userRepository.GetUserByName(request.RequesterName)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+	user, err := s.userRepository.GetUserByID(request.RequesterID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
 		return err
 	}
 
-	if errors.Is(err, sql.ErrNoRows) {
-		user = &repository.User{Name: request.RequesterName}
-		if err := s.userRepository.CreateUser(user); err != nil {
-			return err
-		}
+	// Create the donation request with meal preferences
+	if err := s.donationRequestRepository.CreateDonationRequest(user.ID, request.MealIds); err != nil {
+		return err
 	}
 
-	// Create the donation request with meal preferences
-	return s.donationRequestRepository.CreateDonationRequest(user.ID, request.MealIds)
+	metrics.DonationRequestsCreated.Inc()
+	return nil
 }
 
 func (s *DonationRequestService) GetDonationRequestsByStatus(status string) ([]models.DonationRequestResponse, error) {
@@ -70,7 +73,7 @@ func (s *DonationRequestService) GetDonationRequestsByStatus(status string) ([]m
 
 		response = append(response, models.DonationRequestResponse{
 			ID:            request.ID,
-			RequesterName: request.Requester.Name,
+			RequesterName: displayName(request.Requester, false, false),
 			Description:   description,
 			Status:        request.Status,
 		})
@@ -79,13 +82,16 @@ func (s *DonationRequestService) GetDonationRequestsByStatus(status string) ([]m
 	return response, nil
 }
 
-func (s *DonationRequestService) GetDonationRequestsByRequesterName(name string, date string) ([]models.DonationRequestResponse, error) {
-	user, err := s.userRepository.GetUserByName(name)
+func (s *DonationRequestService) GetDonationRequestsByRequesterID(requesterID uint, date string) ([]models.DonationRequestResponse, error) {
+	user, err := s.userRepository.GetUserByID(requesterID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	requests, err := s.donationRequestRepository.GetDonationRequestsByRequesterName(name, date)
+	requests, err := s.donationRequestRepository.GetDonationRequestsByRequesterID(requesterID, date)
 	if err != nil {
 		return nil, err
 	}
@@ -127,6 +133,12 @@ func (s *DonationRequestService) UpdateDonationRequestStatus(id uint, status str
 }
 
 func (s *DonationRequestService) CheckAndFulfillDonationRequests() error {
-	return s.donationRequestRepository.CheckAndFulfillDonationRequests()
+	timer := prometheus.NewTimer(metrics.MatcherDuration)
+	defer timer.ObserveDuration()
+
+	fulfilled, err := s.donationRequestRepository.CheckAndFulfillDonationRequests()
+	metrics.DonationRequestsFulfilled.Add(float64(fulfilled))
+	metrics.DonationsClaimed.WithLabelValues(metrics.ClaimedByRequest).Add(float64(fulfilled))
+	return err
 }
 
@@ -1,13 +1,17 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"lunchorder/metrics"
 	"lunchorder/models"
 	"lunchorder/repository"
 )
 
 var ErrDonationNotFound = errors.New("donation not found")
+var ErrDonationAlreadyCollected = errors.New("donation has already been collected")
+var ErrDonationRecipientMismatch = errors.New("donation was claimed by someone else")
 
 type DonationService struct {
 	donationRepository *repository.DonationRepository
@@ -32,45 +36,37 @@ func NewDonationService(
 func (service *DonationService) CreateDonation(donationRequest *models.DonationRequest) error {
 	var donation repository.Donation
 
-	donor, err := service.userRepository.GetUserByName(donationRequest.DonorName)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return err
-	}
-
+	donor, err := service.userRepository.GetUserByID(donationRequest.DonorID)
 	if errors.Is(err, sql.ErrNoRows) {
-		donor = &repository.User{Name: donationRequest.DonorName}
-		err = service.userRepository.CreateUser(donor)
+		return ErrUserNotFound
 	}
-
 	if err != nil {
 		return err
 	}
 
 	donation.DonorID = donor.ID
 	donation.MealID = donationRequest.MealID
+	donation.Anonymous = donationRequest.Anonymous
 
 	err = service.donationRepository.CreateDonation(&donation)
-
-	return err
-}
-
-func (service *DonationService) ClaimDonation(donationClaim *models.RecipientRequest) error {
-	user, err := service.userRepository.GetUserByName(donationClaim.Name)
-
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+	if err != nil {
 		return err
 	}
 
+	metrics.DonationsCreated.Inc()
+	return nil
+}
+
+func (service *DonationService) ClaimDonation(ctx context.Context, donationClaim *models.RecipientRequest) error {
+	user, err := service.userRepository.GetUserByID(donationClaim.UserID)
 	if errors.Is(err, sql.ErrNoRows) {
-		user = &repository.User{Name: donationClaim.Name}
-		err = service.userRepository.CreateUser(user)
+		return ErrUserNotFound
 	}
-
 	if err != nil {
 		return err
 	}
 
-	success, err := service.donationRepository.ClaimDonation(donationClaim.DonationID, user)
+	success, err := service.donationRepository.ClaimDonation(ctx, donationClaim.DonationID, user)
 	if err != nil {
 		return err
 	}
@@ -79,6 +75,7 @@ func (service *DonationService) ClaimDonation(donationClaim *models.RecipientReq
 		return ErrDonationNotFound
 	}
 
+	metrics.DonationsClaimed.WithLabelValues(metrics.ClaimedDirectly).Inc()
 	return nil
 }
 
@@ -91,7 +88,7 @@ func (service *DonationService) GetUnclaimedDonationsByDate(today string) ([]mod
 		results = append(results, models.UnclaimedDonationResponse{
 			ID:          donation.ID,
 			Description: donation.Meal.Description,
-			DonorName:   donation.Donor.Name,
+			DonorName:   displayName(donation.Donor, donation.Anonymous, false),
 		})
 	}
 
@@ -111,16 +108,16 @@ func (service *DonationService) GetDonationsSummaryByDate(date string) ([]models
 		donationClaimSummaries = append(donationClaimSummaries, models.DonationClaimSummaryResponse{
 			Claimed:       donation.Recipient.ID != 0,
 			Description:   donation.Meal.Description,
-			DonorName:     donation.Donor.Name,
-			RecipientName: donation.Recipient.Name,
+			DonorName:     displayName(donation.Donor, donation.Anonymous, true),
+			RecipientName: displayName(donation.Recipient, false, true),
 		})
 	}
 
 	return donationClaimSummaries, nil
 }
 
-func (service *DonationService) GetDonationClaimByClaimantName(name string) (models.ClaimedDonationResponse, error) {
-	donation, err := service.donationRepository.GetDonationClaimByClaimantName(name)
+func (service *DonationService) GetDonationClaimByRecipientID(recipientID uint) (models.ClaimedDonationResponse, error) {
+	donation, err := service.donationRepository.GetDonationClaimByRecipientID(recipientID)
 
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return models.ClaimedDonationResponse{}, err
@@ -133,9 +130,59 @@ func (service *DonationService) GetDonationClaimByClaimantName(name string) (mod
 	return models.ClaimedDonationResponse{
 		UnclaimedDonationResponse: models.UnclaimedDonationResponse{
 			ID:          donation.ID,
-			DonorName:   donation.Donor.Name,
+			DonorName:   displayName(donation.Donor, donation.Anonymous, false),
 			Description: donation.Meal.Description,
 		},
 	}, nil
 }
 
+func (service *DonationService) GetClaimedDonation(donationID uint, recipientID uint) (repository.Donation, error) {
+	donation, err := service.donationRepository.GetDonationByID(donationID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return donation, ErrDonationNotFound
+	}
+
+	if err != nil {
+		return donation, err
+	}
+
+	if donation.RecipientID == nil || *donation.RecipientID != recipientID {
+		return donation, ErrDonationRecipientMismatch
+	}
+
+	if donation.CollectedAt != nil {
+		return donation, ErrDonationAlreadyCollected
+	}
+
+	return donation, nil
+}
+
+func (service *DonationService) CollectDonation(ctx context.Context, donationID uint, recipientID uint) (models.DonationCollectResponse, error) {
+	donation, err := service.GetClaimedDonation(donationID, recipientID)
+	if err != nil {
+		return models.DonationCollectResponse{}, err
+	}
+
+	success, err := service.donationRepository.MarkDonationCollected(ctx, donationID, recipientID)
+	if err != nil {
+		return models.DonationCollectResponse{}, err
+	}
+
+	// Someone else scanned the same code between the read and the update
+	if !success {
+		return models.DonationCollectResponse{}, ErrDonationAlreadyCollected
+	}
+
+	recipient, err := service.userRepository.GetUserByID(recipientID)
+	if err != nil {
+		return models.DonationCollectResponse{}, err
+	}
+
+	return models.DonationCollectResponse{
+		ID:            donation.ID,
+		Description:   donation.Meal.Description,
+		DonorName:     displayName(donation.Donor, donation.Anonymous, true),
+		RecipientName: displayName(*recipient, false, true),
+	}, nil
+}
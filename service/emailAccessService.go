@@ -0,0 +1,127 @@
+package service
+
+import (
+	"errors"
+	"lunchorder/models"
+	"lunchorder/repository"
+	"net/mail"
+	"strings"
+)
+
+const (
+	EmailRuleAllow = "allow"
+	EmailRuleDeny  = "deny"
+)
+
+var ErrEmailNotVerified = errors.New("email address has not been verified")
+var ErrEmailNotAllowed = errors.New("email address is not allowed to sign in")
+var ErrInvalidEmailRule = errors.New("rule must be either \"allow\" or \"deny\"")
+var ErrInvalidEmail = errors.New("invalid email address")
+var ErrEmailRuleNotFound = errors.New("email rule not found")
+
+type EmailAccessService struct {
+	emailAccessRepository *repository.EmailAccessRepository
+	allowedDomains        []string
+}
+
+func NewEmailAccessService(emailAccessRepository *repository.EmailAccessRepository, allowedDomains []string) *EmailAccessService {
+	return &EmailAccessService{
+		emailAccessRepository: emailAccessRepository,
+		allowedDomains:        parseDomains(allowedDomains),
+	}
+}
+
+func parseDomains(domains []string) []string {
+	var result []string
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		domain = strings.TrimPrefix(domain, "@")
+		if domain != "" {
+			result = append(result, domain)
+		}
+	}
+	return result
+}
+
+// CheckEmail decides whether an identity may sign in. Explicit deny rules win over
+// everything, explicit allow rules bypass the domain check, and otherwise the
+// address must belong to one of the configured domains.
+func (service *EmailAccessService) CheckEmail(email string, verified bool) error {
+	if !verified {
+		return ErrEmailNotVerified
+	}
+
+	rule, err := service.emailAccessRepository.GetRuleByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	if rule != nil && rule.Rule == EmailRuleDeny {
+		return ErrEmailNotAllowed
+	}
+
+	if rule != nil && rule.Rule == EmailRuleAllow {
+		return nil
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ErrEmailNotAllowed
+	}
+	domain := strings.ToLower(email[at+1:])
+
+	for _, allowed := range service.allowedDomains {
+		if domain == allowed {
+			return nil
+		}
+	}
+
+	return ErrEmailNotAllowed
+}
+
+func (service *EmailAccessService) GetRules() ([]models.EmailAccessRuleResponse, error) {
+	rules, err := service.emailAccessRepository.GetRules()
+	if err != nil {
+		return nil, err
+	}
+
+	response := []models.EmailAccessRuleResponse{}
+	for _, rule := range rules {
+		response = append(response, models.EmailAccessRuleResponse{
+			ID:    rule.ID,
+			Email: rule.Email,
+			Rule:  rule.Rule,
+		})
+	}
+
+	return response, nil
+}
+
+func (service *EmailAccessService) SetRule(request *models.EmailAccessRuleRequest) error {
+	if request.Rule != EmailRuleAllow && request.Rule != EmailRuleDeny {
+		return ErrInvalidEmailRule
+	}
+
+	address, err := mail.ParseAddress(request.Email)
+	if err != nil || address.Address != strings.TrimSpace(request.Email) {
+		return ErrInvalidEmail
+	}
+
+	return service.emailAccessRepository.UpsertRule(&repository.EmailAccessRule{
+		Email: address.Address,
+		Rule:  request.Rule,
+	})
+}
+
+func (service *EmailAccessService) DeleteRule(id uint) error {
+	deleted, err := service.emailAccessRepository.DeleteRule(id)
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return ErrEmailRuleNotFound
+	}
+
+	return nil
+}
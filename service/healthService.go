@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lunchorder/repository"
+	"sync/atomic"
+)
+
+var ErrShuttingDown = errors.New("server is shutting down")
+var ErrDatabaseUnavailable = errors.New("database is unavailable")
+var ErrMigrationsPending = errors.New("database migrations are not applied")
+
+// HealthService answers whether this instance can serve traffic
+type HealthService struct {
+	healthRepository *repository.HealthRepository
+	// migrationVersion is the latest migration this build ships with
+	migrationVersion uint
+	shuttingDown     atomic.Bool
+}
+
+func NewHealthService(healthRepository *repository.HealthRepository, migrationVersion uint) *HealthService {
+	return &HealthService{
+		healthRepository: healthRepository,
+		migrationVersion: migrationVersion,
+	}
+}
+
+// StartShutdown makes Ready fail, so the load balancer stops sending new
+// requests while the in-flight ones finish
+func (s *HealthService) StartShutdown() {
+	s.shuttingDown.Store(true)
+}
+
+// Ready checks that the database answers and has every migration of this
+// build applied. A newer schema from a newer instance is fine.
+func (s *HealthService) Ready(ctx context.Context) error {
+	if s.shuttingDown.Load() {
+		return ErrShuttingDown
+	}
+
+	if err := s.healthRepository.Ping(ctx); err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabaseUnavailable, err)
+	}
+
+	version, err := s.healthRepository.GetMigrationVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabaseUnavailable, err)
+	}
+	if version.Dirty || version.Version < s.migrationVersion {
+		return ErrMigrationsPending
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"lunchorder/models"
+	"lunchorder/repository"
+	"lunchorder/utils"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ImpersonationTTL is how long an admin can act as a user before they are
+// returned to their own session
+const ImpersonationTTL = 15 * time.Minute
+
+var ErrImpersonateSelf = errors.New("you cannot impersonate yourself")
+var ErrImpersonationReasonRequired = errors.New("a reason of at most 255 characters is required")
+var ErrImpersonationEnded = errors.New("impersonation has ended")
+var ErrImpersonationReadOnly = errors.New("impersonation is read-only")
+var ErrNotImpersonating = errors.New("you are not impersonating anyone")
+
+// ImpersonationService lets admins act as another user for support. Every
+// impersonation, and every request made during one, is recorded in the audit log.
+type ImpersonationService struct {
+	impersonationRepository *repository.ImpersonationRepository
+	userRepository          *repository.UserRepository
+	sessionService          *SessionService
+	auditService            *AuditService
+}
+
+func NewImpersonationService(
+	impersonationRepository *repository.ImpersonationRepository,
+	userRepository *repository.UserRepository,
+	sessionService *SessionService,
+	auditService *AuditService) *ImpersonationService {
+
+	return &ImpersonationService{
+		impersonationRepository: impersonationRepository,
+		userRepository:          userRepository,
+		sessionService:          sessionService,
+		auditService:            auditService,
+	}
+}
+
+// StartImpersonation lets admin, signed in with adminSessionID, act as userID.
+// Returns the impersonation and the impersonated user.
+func (s *ImpersonationService) StartImpersonation(admin *repository.User, adminSessionID string, userID uint, request *models.ImpersonationRequest) (*repository.Impersonation, *repository.User, error) {
+	reason := strings.TrimSpace(request.Reason)
+	if reason == "" || utf8.RuneCountInString(reason) > 255 {
+		return nil, nil, ErrImpersonationReasonRequired
+	}
+
+	if userID == admin.ID {
+		return nil, nil, ErrImpersonateSelf
+	}
+
+	user, err := s.userRepository.GetUserByID(userID)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && user.DeletedAt != nil {
+		return nil, nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.Active {
+		return nil, nil, ErrUserDeactivated
+	}
+
+	id, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	impersonation := &repository.Impersonation{
+		ID:             id,
+		AdminUserID:    admin.ID,
+		AdminSessionID: adminSessionID,
+		UserID:         user.ID,
+		Reason:         reason,
+		AllowWrites:    request.AllowWrites,
+	}
+	if err := s.impersonationRepository.CreateImpersonation(impersonation, ImpersonationTTL); err != nil {
+		return nil, nil, err
+	}
+
+	detail := fmt.Sprintf("reason: %s; writes allowed: %t", reason, request.AllowWrites)
+	if err := s.auditService.Record(admin.ID, user.ID, AuditImpersonationStart, detail); err != nil {
+		return nil, nil, err
+	}
+
+	// Read it back for the expiry set by the database
+	impersonation, err = s.impersonationRepository.GetActiveImpersonation(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return impersonation, user, nil
+}
+
+// Authenticate returns the impersonation with the given id and the admin
+// behind it, or ErrImpersonationEnded if it has ended or expired, or the admin
+// has since lost their rights or the session they started it from was revoked.
+func (s *ImpersonationService) Authenticate(id string) (*repository.Impersonation, *repository.User, error) {
+	impersonation, err := s.impersonationRepository.GetActiveImpersonation(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrImpersonationEnded
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revoked, err := s.sessionService.IsRevoked(impersonation.AdminSessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revoked {
+		if err := s.EndImpersonation(impersonation); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrImpersonationEnded
+	}
+
+	admin, err := s.userRepository.GetUserByID(impersonation.AdminUserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !admin.IsAdmin || !admin.Active || admin.DeletedAt != nil {
+		return nil, nil, ErrImpersonationEnded
+	}
+
+	return impersonation, admin, nil
+}
+
+func (s *ImpersonationService) EndImpersonation(impersonation *repository.Impersonation) error {
+	ended, err := s.impersonationRepository.EndImpersonation(impersonation.ID)
+	if err != nil || !ended {
+		return err
+	}
+	return s.auditService.Record(impersonation.AdminUserID, impersonation.UserID, AuditImpersonationEnd, "")
+}
+
+// EndImpersonationByID ends the impersonation, if it is still running, and
+// returns the admin session it was started from
+func (s *ImpersonationService) EndImpersonationByID(id string) (string, error) {
+	impersonation, err := s.impersonationRepository.GetImpersonationByID(id)
+	if err != nil {
+		return "", err
+	}
+	return impersonation.AdminSessionID, s.EndImpersonation(impersonation)
+}
+
+// RecordRequest logs a request the admin made while impersonating
+func (s *ImpersonationService) RecordRequest(impersonation *repository.Impersonation, method string, path string, status int) error {
+	detail := fmt.Sprintf("%s %s -> %d", method, path, status)
+	return s.auditService.Record(impersonation.AdminUserID, impersonation.UserID, AuditImpersonationRequest, detail)
+}
+
+func ToImpersonationResponse(impersonation *repository.Impersonation, admin *repository.User) models.ImpersonationResponse {
+	return models.ImpersonationResponse{
+		ImpersonatorID:   admin.ID,
+		ImpersonatorName: admin.Name,
+		UserID:           impersonation.UserID,
+		Reason:           impersonation.Reason,
+		ReadOnly:         !impersonation.AllowWrites,
+		ExpiresAt:        impersonation.ExpiresAt,
+	}
+}
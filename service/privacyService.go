@@ -0,0 +1,232 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"lunchorder/models"
+	"lunchorder/repository"
+	"strings"
+	"time"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+var ErrInvalidNameVisibility = errors.New("nameVisibility must be everyone, admins or nobody")
+
+// Who a user's name is shown to in donations and requests that are not their own
+const (
+	NameVisibleToEveryone = "everyone"
+	NameVisibleToAdmins   = "admins"
+	NameVisibleToNobody   = "nobody"
+)
+
+// AnonymousName replaces names that are hidden from the viewer
+const AnonymousName = "Anonymous"
+
+// displayName returns user's name as shown to someone else, an admin or not.
+// Anonymous donations hide the donor from everyone.
+func displayName(user repository.User, anonymous bool, toAdmin bool) string {
+	if user.ID == 0 {
+		return ""
+	}
+	switch {
+	case anonymous, user.NameVisibility == NameVisibleToNobody:
+		return AnonymousName
+	case user.NameVisibility == NameVisibleToAdmins && !toAdmin:
+		return AnonymousName
+	}
+	return user.Name
+}
+
+// PrivacyService answers data subject requests: exporting everything stored
+// about a user and erasing it again.
+type PrivacyService struct {
+	userRepository            *repository.UserRepository
+	donationRepository        *repository.DonationRepository
+	donationRequestRepository *repository.DonationRequestRepository
+	sessionRepository         *repository.SessionRepository
+	apiTokenRepository        *repository.ApiTokenRepository
+	sessionService            *SessionService
+}
+
+func NewPrivacyService(
+	userRepository *repository.UserRepository,
+	donationRepository *repository.DonationRepository,
+	donationRequestRepository *repository.DonationRequestRepository,
+	sessionRepository *repository.SessionRepository,
+	apiTokenRepository *repository.ApiTokenRepository,
+	sessionService *SessionService) *PrivacyService {
+
+	return &PrivacyService{
+		userRepository:            userRepository,
+		donationRepository:        donationRepository,
+		donationRequestRepository: donationRequestRepository,
+		sessionRepository:         sessionRepository,
+		apiTokenRepository:        apiTokenRepository,
+		sessionService:            sessionService,
+	}
+}
+
+// ExportUserData collects every row tied to the user, decrypted
+func (s *PrivacyService) ExportUserData(userID uint) (models.PersonalDataExport, error) {
+	user, err := s.userRepository.GetUserByID(userID)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && user.DeletedAt != nil {
+		return models.PersonalDataExport{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.PersonalDataExport{}, err
+	}
+
+	export := models.PersonalDataExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: models.PersonalDataProfile{
+			ID:          user.ID,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+			Name:        user.Name,
+			Email:       user.Email,
+			GoogleID:    user.GoogleID,
+			FirstName:   user.FirstName,
+			LastName:    user.LastName,
+			AvatarURL:   user.AvatarURL,
+			IsAdmin:     user.IsAdmin,
+			Privacy:     models.PrivacySettings{NameVisibility: user.NameVisibility},
+			Preferences: toUserPreferences(user),
+		},
+		Identities:       []models.PersonalDataIdentity{},
+		Donations:        []models.PersonalDataDonation{},
+		DonationRequests: []models.PersonalDataDonationRequest{},
+		Sessions:         []models.PersonalDataSession{},
+		ApiTokens:        []models.PersonalDataApiToken{},
+	}
+
+	identities, err := s.userRepository.GetUserIdentities(userID)
+	if err != nil {
+		return export, err
+	}
+	for _, identity := range identities {
+		export.Identities = append(export.Identities, models.PersonalDataIdentity{
+			Provider:  identity.Provider,
+			Subject:   identity.Subject,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+
+	donations, err := s.donationRepository.GetDonationsByUser(userID)
+	if err != nil {
+		return export, err
+	}
+	for _, donation := range donations {
+		role := "donor"
+		donorName := donation.Donor.Name
+		recipientName := displayName(donation.Recipient, false, false)
+		if donation.DonorID != userID {
+			role = "recipient"
+			donorName = displayName(donation.Donor, donation.Anonymous, false)
+			recipientName = donation.Recipient.Name
+		}
+		export.Donations = append(export.Donations, models.PersonalDataDonation{
+			ID:            donation.ID,
+			CreatedAt:     donation.CreatedAt,
+			Role:          role,
+			Anonymous:     donation.Anonymous,
+			Description:   donation.Meal.Description,
+			Date:          donation.Meal.Date,
+			DonorName:     donorName,
+			RecipientName: recipientName,
+			CollectedAt:   donation.CollectedAt,
+		})
+	}
+
+	requests, err := s.donationRequestRepository.GetAllDonationRequestsByRequester(userID)
+	if err != nil {
+		return export, err
+	}
+	for _, request := range requests {
+		meals, err := s.donationRequestRepository.GetDonationRequestMealPreferences(request.ID)
+		if err != nil {
+			return export, err
+		}
+		mealResponses := []models.MealResponse{}
+		for _, meal := range meals {
+			mealResponses = append(mealResponses, models.MealResponse{
+				ID:          meal.ID,
+				Description: meal.Description,
+				Date:        meal.Date,
+			})
+		}
+		export.DonationRequests = append(export.DonationRequests, models.PersonalDataDonationRequest{
+			ID:         request.ID,
+			CreatedAt:  request.CreatedAt,
+			Status:     request.Status,
+			DonationID: request.DonationID,
+			Meals:      mealResponses,
+		})
+	}
+
+	sessions, err := s.sessionRepository.GetUserSessions(userID)
+	if err != nil {
+		return export, err
+	}
+	for _, session := range sessions {
+		export.Sessions = append(export.Sessions, models.PersonalDataSession{
+			ID:         session.ID,
+			CreatedAt:  session.CreatedAt,
+			ExpiresAt:  session.ExpiresAt,
+			LastUsedAt: session.LastUsedAt,
+			RevokedAt:  session.RevokedAt,
+		})
+	}
+
+	tokens, err := s.apiTokenRepository.GetAllApiTokensByUser(userID)
+	if err != nil {
+		return export, err
+	}
+	for _, token := range tokens {
+		export.ApiTokens = append(export.ApiTokens, models.PersonalDataApiToken{
+			ID:          token.ID,
+			Name:        token.Name,
+			TokenPrefix: token.TokenPrefix,
+			Scopes:      strings.Split(token.Scopes, ","),
+			CreatedAt:   token.CreatedAt,
+			ExpiresAt:   token.ExpiresAt,
+			LastUsedAt:  token.LastUsedAt,
+			RevokedAt:   token.RevokedAt,
+		})
+	}
+
+	return export, nil
+}
+
+// EraseUser anonymises the user and signs them out everywhere. Their donations
+// are kept against the anonymised row so the donation totals do not change.
+func (s *PrivacyService) EraseUser(userID uint) error {
+	erased, err := s.userRepository.AnonymiseUser(userID)
+	if err != nil {
+		return err
+	}
+	if !erased {
+		return ErrUserNotFound
+	}
+
+	return s.sessionService.RevokeUserSessions(userID)
+}
+
+func (s *PrivacyService) GetPrivacySettings(userID uint) (models.PrivacySettings, error) {
+	user, err := s.userRepository.GetUserByID(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.PrivacySettings{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.PrivacySettings{}, err
+	}
+	return models.PrivacySettings{NameVisibility: user.NameVisibility}, nil
+}
+
+func (s *PrivacyService) UpdatePrivacySettings(userID uint, settings *models.PrivacySettings) error {
+	switch settings.NameVisibility {
+	case NameVisibleToEveryone, NameVisibleToAdmins, NameVisibleToNobody:
+	default:
+		return ErrInvalidNameVisibility
+	}
+	return s.userRepository.SetNameVisibility(userID, settings.NameVisibility)
+}
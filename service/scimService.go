@@ -0,0 +1,257 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"lunchorder/models"
+	"lunchorder/repository"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrScimUserExists = errors.New("a user with this userName already exists")
+var ErrScimInvalidUserName = errors.New("userName must be an email address")
+var ErrScimInvalidPatch = errors.New("only the active attribute can be changed")
+var ErrScimInvalidFilter = errors.New(`only filters of the form userName eq "..." are supported`)
+
+// scimMaxCount caps the page size, as every user on a page is decrypted
+const scimMaxCount = 1000
+
+// scimUserNameFilter is the one filter identity providers send before
+// provisioning a user, to find out whether they already exist
+var scimUserNameFilter = regexp.MustCompile(`(?i)^\s*userName\s+eq\s+"([^"]*)"\s*$`)
+
+// ScimService maps SCIM users onto users. userName is the user's email, which
+// is how a provisioned user is matched to their login on first sign-in.
+type ScimService struct {
+	userRepository *repository.UserRepository
+	userService    *UserService
+	privacyService *PrivacyService
+}
+
+func NewScimService(
+	userRepository *repository.UserRepository,
+	userService *UserService,
+	privacyService *PrivacyService) *ScimService {
+
+	return &ScimService{
+		userRepository: userRepository,
+		userService:    userService,
+		privacyService: privacyService,
+	}
+}
+
+func (s *ScimService) CreateUser(request *models.ScimUser) (models.ScimUser, error) {
+	email := strings.ToLower(strings.TrimSpace(request.UserName))
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return models.ScimUser{}, ErrScimInvalidUserName
+	}
+
+	_, err := s.userRepository.GetUserByEmail(email)
+	if err == nil {
+		return models.ScimUser{}, ErrScimUserExists
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.ScimUser{}, err
+	}
+
+	user := repository.User{
+		Name:  scimDisplayName(request, email),
+		Email: &email,
+	}
+	if request.Name != nil {
+		user.FirstName = trimmedOrNil(&request.Name.GivenName)
+		user.LastName = trimmedOrNil(&request.Name.FamilyName)
+	}
+	if err := s.userRepository.CreateUser(&user); err != nil {
+		return models.ScimUser{}, err
+	}
+
+	if request.Active != nil && !*request.Active {
+		if err := s.userService.setActive(user.ID, false); err != nil {
+			return models.ScimUser{}, err
+		}
+	}
+
+	return s.GetUser(user.ID)
+}
+
+func (s *ScimService) GetUser(id uint) (models.ScimUser, error) {
+	user, err := s.getUser(id)
+	if err != nil {
+		return models.ScimUser{}, err
+	}
+	return toScimUser(user), nil
+}
+
+// ListUsers pages through all users in id order, or finds one by userName.
+// startIndex is 1-based, as in SCIM, and count is capped at scimMaxCount.
+func (s *ScimService) ListUsers(filter string, startIndex int, count int) (models.ScimListResponse, error) {
+	startIndex = max(startIndex, 1)
+	count = min(max(count, 0), scimMaxCount)
+
+	var page []repository.User
+	var total int
+
+	if filter != "" {
+		match := scimUserNameFilter.FindStringSubmatch(filter)
+		if match == nil {
+			return models.ScimListResponse{}, ErrScimInvalidFilter
+		}
+		user, err := s.userRepository.GetUserByEmail(strings.ToLower(match[1]))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return models.ScimListResponse{}, err
+		}
+		if err == nil && user.DeletedAt == nil {
+			total = 1
+			if startIndex == 1 && count > 0 {
+				page = append(page, *user)
+			}
+		}
+	} else {
+		var err error
+		if total, err = s.userRepository.CountUsers(); err != nil {
+			return models.ScimListResponse{}, err
+		}
+		if count > 0 && startIndex <= total {
+			if page, err = s.userRepository.GetUsersPage(startIndex-1, count); err != nil {
+				return models.ScimListResponse{}, err
+			}
+		}
+	}
+
+	response := models.ScimListResponse{
+		Schemas:      []string{models.ScimListSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    []models.ScimUser{},
+	}
+	for i := range page {
+		response.Resources = append(response.Resources, toScimUser(&page[i]))
+	}
+	return response, nil
+}
+
+// PatchUser applies a PatchOp. Only active can be changed, see
+// UserService.SetUserActive for what deactivating does.
+func (s *ScimService) PatchUser(id uint, patch *models.ScimPatchRequest) (models.ScimUser, error) {
+	user, err := s.getUser(id)
+	if err != nil {
+		return models.ScimUser{}, err
+	}
+
+	active := user.Active
+	for _, operation := range patch.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != "replace" && op != "add" {
+			return models.ScimUser{}, ErrScimInvalidPatch
+		}
+		if active, err = patchedActive(operation); err != nil {
+			return models.ScimUser{}, err
+		}
+	}
+
+	if active != user.Active {
+		if err := s.userService.setActive(id, active); err != nil {
+			return models.ScimUser{}, err
+		}
+	}
+
+	return s.GetUser(id)
+}
+
+// DeleteUser erases the user, as account erasure does
+func (s *ScimService) DeleteUser(id uint) error {
+	if _, err := s.getUser(id); err != nil {
+		return err
+	}
+	return s.privacyService.EraseUser(id)
+}
+
+// getUser returns the user, or ErrUserNotFound if they do not exist or were deleted
+func (s *ScimService) getUser(id uint) (*repository.User, error) {
+	user, err := s.userRepository.GetUserByID(id)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+// patchedActive reads the new active flag from one patch operation
+func patchedActive(operation models.ScimPatchOperation) (bool, error) {
+	value := operation.Value
+
+	if operation.Path == "" {
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(value, &attributes); err != nil || len(attributes) != 1 {
+			return false, ErrScimInvalidPatch
+		}
+		for name, attribute := range attributes {
+			if !strings.EqualFold(name, "active") {
+				return false, ErrScimInvalidPatch
+			}
+			value = attribute
+		}
+	} else if !strings.EqualFold(operation.Path, "active") {
+		return false, ErrScimInvalidPatch
+	}
+
+	var active bool
+	if err := json.Unmarshal(value, &active); err == nil {
+		return active, nil
+	}
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		if active, err := strconv.ParseBool(text); err == nil {
+			return active, nil
+		}
+	}
+	return false, ErrScimInvalidPatch
+}
+
+func scimDisplayName(request *models.ScimUser, email string) string {
+	if name := strings.TrimSpace(request.DisplayName); name != "" {
+		return name
+	}
+	if request.Name != nil {
+		if name := strings.TrimSpace(request.Name.GivenName + " " + request.Name.FamilyName); name != "" {
+			return name
+		}
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return local
+}
+
+func toScimUser(user *repository.User) models.ScimUser {
+	id := strconv.FormatUint(uint64(user.ID), 10)
+	active := user.Active
+
+	scimUser := models.ScimUser{
+		Schemas:     []string{models.ScimUserSchema},
+		ID:          id,
+		DisplayName: user.Name,
+		Name:        &models.ScimName{},
+		Active:      &active,
+		Meta: &models.ScimMeta{
+			ResourceType: models.ScimUserResourceType,
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     "/scim/v2/Users/" + id,
+		},
+	}
+	if user.Email != nil {
+		scimUser.UserName = *user.Email
+		scimUser.Emails = []models.ScimEmail{{Value: *user.Email, Type: "work", Primary: true}}
+	}
+	if user.FirstName != nil {
+		scimUser.Name.GivenName = *user.FirstName
+	}
+	if user.LastName != nil {
+		scimUser.Name.FamilyName = *user.LastName
+	}
+	return scimUser
+}
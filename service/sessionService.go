@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"lunchorder/models"
+	"lunchorder/repository"
+	"lunchorder/utils"
+	"sync"
+	"time"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+
+	// revocationCacheTTL bounds how long another instance's revocation can go unnoticed
+	revocationCacheTTL = 30 * time.Second
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+type revocationEntry struct {
+	revoked   bool
+	checkedAt time.Time
+}
+
+type SessionService struct {
+	sessionRepository       *repository.SessionRepository
+	impersonationRepository *repository.ImpersonationRepository
+	auditService            *AuditService
+
+	mu              sync.Mutex
+	revocationCache map[string]revocationEntry
+	lastSweep       time.Time
+}
+
+func NewSessionService(
+	sessionRepository *repository.SessionRepository,
+	impersonationRepository *repository.ImpersonationRepository,
+	auditService *AuditService) *SessionService {
+
+	return &SessionService{
+		sessionRepository:       sessionRepository,
+		impersonationRepository: impersonationRepository,
+		auditService:            auditService,
+		revocationCache:         map[string]revocationEntry{},
+	}
+}
+
+// CreateSession starts a new login session and returns its ID (used as the
+// access token jti) and the refresh token to hand to the client
+func (s *SessionService) CreateSession(userID uint) (string, string, error) {
+	sessionID, err := utils.RandomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	session := &repository.Session{
+		ID:               sessionID,
+		UserID:           userID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+	}
+	if err := s.sessionRepository.CreateSession(session, RefreshTokenTTL); err != nil {
+		return "", "", err
+	}
+
+	return sessionID, refreshToken, nil
+}
+
+// RefreshSession exchanges a refresh token for a new one, extending the session.
+// The new refresh token is empty when the presented one was just rotated by another request.
+// A refresh token presented again after that grace period has been stolen or
+// leaked, so the session is revoked for whoever holds its current token too.
+func (s *SessionService) RefreshSession(ctx context.Context, refreshToken string) (*repository.Session, string, error) {
+	if refreshToken == "" {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	oldHash := utils.HashToken(refreshToken)
+	session, err := s.sessionRepository.GetSessionByRefreshToken(oldHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", s.revokeReusedRefreshToken(ctx, oldHash)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Lost a race with a parallel refresh: keep the session but leave the refresh token the winner set
+	if session.RefreshTokenHash != oldHash {
+		return session, "", nil
+	}
+
+	newRefreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rotated, err := s.sessionRepository.RotateRefreshToken(session.ID, oldHash, utils.HashToken(newRefreshToken), RefreshTokenTTL)
+	if err != nil {
+		return nil, "", err
+	}
+	if !rotated {
+		return session, "", nil
+	}
+
+	return session, newRefreshToken, nil
+}
+
+// revokeReusedRefreshToken revokes the session a rotated refresh token belonged
+// to, if any, and returns ErrInvalidRefreshToken
+func (s *SessionService) revokeReusedRefreshToken(ctx context.Context, refreshTokenHash string) error {
+	session, err := s.sessionRepository.GetSessionByPreviousRefreshToken(refreshTokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.WarnContext(ctx, "Refresh token reused after rotation, revoking the session", "session_id", session.ID, "user_id", session.UserID)
+	if err := s.RevokeSession(session.ID); err != nil {
+		return err
+	}
+	return ErrInvalidRefreshToken
+}
+
+// IsRevoked reports whether the session is revoked or gone, caching the answer briefly
+func (s *SessionService) IsRevoked(sessionID string) (bool, error) {
+	s.mu.Lock()
+	entry, ok := s.revocationCache[sessionID]
+	s.mu.Unlock()
+
+	if ok && time.Since(entry.checkedAt) < revocationCacheTTL {
+		return entry.revoked, nil
+	}
+
+	session, err := s.sessionRepository.GetSessionByID(sessionID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	revoked := session == nil || session.RevokedAt != nil
+	s.setCached(sessionID, revoked)
+
+	return revoked, nil
+}
+
+func (s *SessionService) RevokeSession(sessionID string) error {
+	if err := s.sessionRepository.RevokeSession(sessionID); err != nil {
+		return err
+	}
+	s.setCached(sessionID, true)
+	return nil
+}
+
+// RevokeUserSessions logs the user out everywhere and ends any impersonation
+// they started as an admin
+func (s *SessionService) RevokeUserSessions(userID uint) error {
+	sessions, err := s.sessionRepository.GetActiveUserSessions(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.sessionRepository.RevokeUserSessions(userID); err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		s.setCached(session.ID, true)
+	}
+
+	impersonations, err := s.impersonationRepository.GetActiveAdminImpersonations(userID)
+	if err != nil {
+		return err
+	}
+	for _, impersonation := range impersonations {
+		ended, err := s.impersonationRepository.EndImpersonation(impersonation.ID)
+		if err != nil {
+			return err
+		}
+		if ended {
+			if err := s.auditService.Record(impersonation.AdminUserID, impersonation.UserID, AuditImpersonationEnd, "admin sessions revoked"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *SessionService) GetActiveUserSessions(userID uint, currentSessionID string) ([]models.SessionResponse, error) {
+	sessions, err := s.sessionRepository.GetActiveUserSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := []models.SessionResponse{}
+	for _, session := range sessions {
+		response = append(response, models.SessionResponse{
+			ID:         session.ID,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentSessionID,
+		})
+	}
+
+	return response, nil
+}
+
+func (s *SessionService) setCached(sessionID string, revoked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop stale entries so the cache cannot grow without bound. Sweeping at
+	// most once per TTL keeps the cost per write constant on average.
+	if now.Sub(s.lastSweep) >= revocationCacheTTL {
+		for id, entry := range s.revocationCache {
+			if now.Sub(entry.checkedAt) >= revocationCacheTTL {
+				delete(s.revocationCache, id)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	s.revocationCache[sessionID] = revocationEntry{revoked: revoked, checkedAt: now}
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"lunchorder/models"
+	"lunchorder/repository"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	// The runtime image has no zoneinfo, and user timezones must still load
+	_ "time/tzdata"
+)
+
+var ErrMergeSameUser = errors.New("cannot merge a user into themselves")
+var ErrUserDeactivated = errors.New("this account has been deactivated")
+var ErrDeactivateSelf = errors.New("you cannot deactivate your own account")
+var ErrInvalidDisplayName = errors.New("name must be between 1 and 100 characters")
+var ErrInvalidNotificationChannel = errors.New("notificationChannels may only contain email and push")
+var ErrInvalidDietaryProfile = errors.New("dietaryProfile contains an unknown entry")
+var ErrInvalidPickupLocation = errors.New("defaultPickupLocation must be at most 100 characters")
+var ErrInvalidTimezone = errors.New("timezone must be an IANA time zone such as Europe/Berlin")
+
+// NotificationChannels are the channels a user can be notified on
+var NotificationChannels = []string{"email", "push"}
+
+// DietaryOptions are the entries a dietary profile is made of
+var DietaryOptions = []string{"vegetarian", "vegan", "pescatarian", "gluten_free", "dairy_free", "nut_free", "halal", "kosher"}
+
+type UserService struct {
+	userRepository      *repository.UserRepository
+	userMergeRepository *repository.UserMergeRepository
+	sessionService      *SessionService
+}
+
+func NewUserService(
+	userRepository *repository.UserRepository,
+	userMergeRepository *repository.UserMergeRepository,
+	sessionService *SessionService) *UserService {
+
+	return &UserService{
+		userRepository:      userRepository,
+		userMergeRepository: userMergeRepository,
+		sessionService:      sessionService,
+	}
+}
+
+// MergeUsers folds a duplicate account into the one that is kept and signs the
+// duplicate out everywhere
+func (s *UserService) MergeUsers(request *models.UserMergeRequest, adminID uint) (models.UserMergeResponse, error) {
+	if request.SourceUserID == request.TargetUserID {
+		return models.UserMergeResponse{}, ErrMergeSameUser
+	}
+
+	source, err := s.getActiveUser(request.SourceUserID)
+	if err != nil {
+		return models.UserMergeResponse{}, err
+	}
+	target, err := s.getActiveUser(request.TargetUserID)
+	if err != nil {
+		return models.UserMergeResponse{}, err
+	}
+
+	merge, err := s.userMergeRepository.MergeUsers(source, target, adminID)
+	if err != nil {
+		return models.UserMergeResponse{}, err
+	}
+
+	if err := s.sessionService.RevokeUserSessions(source.ID); err != nil {
+		return models.UserMergeResponse{}, err
+	}
+
+	return toUserMergeResponse(*merge), nil
+}
+
+func (s *UserService) GetUserMerges() ([]models.UserMergeResponse, error) {
+	merges, err := s.userMergeRepository.GetUserMerges()
+	if err != nil {
+		return nil, err
+	}
+
+	response := []models.UserMergeResponse{}
+	for _, merge := range merges {
+		response = append(response, toUserMergeResponse(merge))
+	}
+	return response, nil
+}
+
+// GetUsers lists every user that has not been deleted, for admins
+func (s *UserService) GetUsers() ([]models.AdminUserResponse, error) {
+	users, err := s.userRepository.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	response := []models.AdminUserResponse{}
+	for _, user := range users {
+		if user.DeletedAt != nil {
+			continue
+		}
+		response = append(response, models.AdminUserResponse{
+			ID:        user.ID,
+			CreatedAt: user.CreatedAt,
+			Handle:    user.Handle,
+			Name:      user.Name,
+			Email:     user.Email,
+			IsAdmin:   user.IsAdmin,
+			Active:    user.Active,
+		})
+	}
+	return response, nil
+}
+
+// SetUserActive activates or deactivates a user. A deactivated user is signed
+// out everywhere and can no longer sign in or use the API; their pending
+// requests are cancelled and their unclaimed donations withdrawn.
+func (s *UserService) SetUserActive(userID uint, active bool, adminID uint) error {
+	if userID == adminID && !active {
+		return ErrDeactivateSelf
+	}
+	if _, err := s.getActiveUser(userID); err != nil {
+		return err
+	}
+	return s.setActive(userID, active)
+}
+
+func (s *UserService) setActive(userID uint, active bool) error {
+	if err := s.userRepository.SetUserActive(userID, active); err != nil {
+		return err
+	}
+	if active {
+		return nil
+	}
+	return s.sessionService.RevokeUserSessions(userID)
+}
+
+func (s *UserService) GetProfile(userID uint) (models.UserProfileResponse, error) {
+	user, err := s.getActiveUser(userID)
+	if err != nil {
+		return models.UserProfileResponse{}, err
+	}
+	return toUserProfileResponse(user), nil
+}
+
+// UpdateProfile replaces the user's display name and preferences. A name the
+// user chose is no longer overwritten by the identity provider on sign-in.
+func (s *UserService) UpdateProfile(userID uint, update *models.UserProfileUpdate) (models.UserProfileResponse, error) {
+	name := strings.TrimSpace(update.Name)
+	if name == "" || utf8.RuneCountInString(name) > 100 {
+		return models.UserProfileResponse{}, ErrInvalidDisplayName
+	}
+	if !containsOnly(NotificationChannels, update.NotificationChannels) {
+		return models.UserProfileResponse{}, ErrInvalidNotificationChannel
+	}
+	if !containsOnly(DietaryOptions, update.DietaryProfile) {
+		return models.UserProfileResponse{}, ErrInvalidDietaryProfile
+	}
+
+	pickupLocation := trimmedOrNil(update.DefaultPickupLocation)
+	if pickupLocation != nil && utf8.RuneCountInString(*pickupLocation) > 100 {
+		return models.UserProfileResponse{}, ErrInvalidPickupLocation
+	}
+
+	timezone := trimmedOrNil(update.Timezone)
+	if timezone != nil {
+		if _, err := time.LoadLocation(*timezone); err != nil || *timezone == "Local" {
+			return models.UserProfileResponse{}, ErrInvalidTimezone
+		}
+	}
+
+	user, err := s.getActiveUser(userID)
+	if err != nil {
+		return models.UserProfileResponse{}, err
+	}
+
+	user.NameIsCustom = user.NameIsCustom || name != user.Name
+	user.Name = name
+	user.NotificationChannels = strings.Join(uniqueSorted(update.NotificationChannels), ",")
+	user.DietaryProfile = nil
+	if len(update.DietaryProfile) > 0 {
+		dietaryProfile := strings.Join(uniqueSorted(update.DietaryProfile), ",")
+		user.DietaryProfile = &dietaryProfile
+	}
+	user.PickupLocation = pickupLocation
+	user.Timezone = timezone
+
+	if err := s.userRepository.UpdateUserPreferences(user); err != nil {
+		return models.UserProfileResponse{}, err
+	}
+	return toUserProfileResponse(user), nil
+}
+
+// getActiveUser returns the user, or ErrUserNotFound if they do not exist or were deleted
+func (s *UserService) getActiveUser(id uint) (*repository.User, error) {
+	user, err := s.userRepository.GetUserByID(id)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+func toUserMergeResponse(merge repository.UserMerge) models.UserMergeResponse {
+	return models.UserMergeResponse{
+		ID:              merge.ID,
+		CreatedAt:       merge.CreatedAt,
+		SourceUserID:    merge.SourceUserID,
+		TargetUserID:    merge.TargetUserID,
+		MergedByUserID:  merge.MergedByUserID,
+		DonationsMoved:  merge.DonationsMoved,
+		ReceivedMoved:   merge.ReceivedMoved,
+		RequestsMoved:   merge.RequestsMoved,
+		IdentitiesMoved: merge.IdentitiesMoved,
+	}
+}
+
+func toUserProfileResponse(user *repository.User) models.UserProfileResponse {
+	return models.UserProfileResponse{
+		ID:          user.ID,
+		Handle:      user.Handle,
+		Name:        user.Name,
+		Email:       user.Email,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		AvatarURL:   user.AvatarURL,
+		IsAdmin:     user.IsAdmin,
+		Preferences: toUserPreferences(user),
+	}
+}
+
+func toUserPreferences(user *repository.User) models.UserPreferences {
+	preferences := models.UserPreferences{
+		NotificationChannels:  splitList(user.NotificationChannels),
+		DietaryProfile:        []string{},
+		DefaultPickupLocation: user.PickupLocation,
+		Timezone:              user.Timezone,
+	}
+	if user.DietaryProfile != nil {
+		preferences.DietaryProfile = splitList(*user.DietaryProfile)
+	}
+	return preferences
+}
+
+// splitList splits a comma-separated column, giving an empty list for ""
+func splitList(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+func containsOnly(allowed []string, values []string) bool {
+	for _, value := range values {
+		if !slices.Contains(allowed, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func uniqueSorted(values []string) []string {
+	result := slices.Clone(values)
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+func trimmedOrNil(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
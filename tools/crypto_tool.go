@@ -1,50 +1,257 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"lunchorder/config"
+	"lunchorder/repository"
 	"lunchorder/utils"
 	"os"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/jmoiron/sqlx"
 )
 
 func main() {
-	action := flag.String("action", "", "encrypt, decrypt, or hash")
+	action := flag.String("action", "", "encrypt, decrypt, hash, rotate, or verify")
 	input := flag.String("input", "", "text to process")
+	index := flag.String("index", "users.email_hash", "hash: blind index to hash for, as table.column")
+	userID := flag.Uint("user-id", 0, "encrypt/decrypt: use this user's own key (needs the database)")
+	table := flag.String("table", "", "rotate/verify: start at this table when resuming")
+	afterID := flag.Uint("after-id", 0, "rotate/verify: resume after this id")
+	batchSize := flag.Int("batch-size", 500, "rotate/verify: rows per batch")
+	repair := flag.Bool("repair", false, "verify: recompute wrong, missing and orphaned blind indexes")
+	report := flag.String("report", "", "verify: write the JSON report to this file instead of stdout")
 	flag.Parse()
 
-	if *action == "" || *input == "" {
-		fmt.Println("Usage: go run tools/crypto_tool.go -action=[encrypt|decrypt|hash] -input=\"text\"")
+	if *action == "" || (*action != "rotate" && *action != "verify" && *input == "") {
+		fmt.Println("Usage: go run tools/crypto_tool.go -action=[encrypt|decrypt|hash] -input=\"text\" [-index=users.email_hash] [-user-id=0]")
+		fmt.Println("       go run tools/crypto_tool.go -action=rotate [-table=users] [-after-id=0] [-batch-size=500]")
+		fmt.Println("       go run tools/crypto_tool.go -action=verify [-repair] [-report=report.json] [-table=users] [-after-id=0] [-batch-size=500]")
 		os.Exit(1)
 	}
 
-	// Load .env from project root
-	_ = godotenv.Load()
+	// Reads .env from the project root, like the app
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	key, err := utils.GetEncryptionKey()
+	keys, err := utils.LoadDataKeys(cfg.Encryption)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	var cipher utils.FieldCipher = keys
+	if *userID != 0 && (*action == "encrypt" || *action == "decrypt") {
+		cipher = userCipher(cfg, keys, *userID)
+	}
+
 	switch *action {
 	case "encrypt":
-		res, err := utils.Encrypt(*input, key)
+		res, err := cipher.Encrypt(*input)
 		if err != nil {
 			log.Fatal(err)
 		}
 		fmt.Printf("Encrypted: %s\n", res)
 	case "decrypt":
-		res, err := utils.Decrypt(*input, key)
+		res, err := cipher.Decrypt(*input)
 		if err != nil {
 			log.Fatal(err)
 		}
 		fmt.Printf("Decrypted: %s\n", res)
 	case "hash":
-		res := utils.Hash(*input, key)
+		res := keys.Hash(*index, *input)
 		fmt.Printf("Hash: %s\n", res)
+	case "rotate":
+		rotate(cfg, keys, *table, *afterID, *batchSize)
+	case "verify":
+		verify(cfg, keys, *table, *afterID, *batchSize, *repair, *report)
 	default:
 		log.Fatal("Unknown action")
 	}
 }
+
+// connect opens the database and the user keys, as the app does
+func connect(cfg *config.Config, keys *utils.DataKeys) (*sqlx.DB, *repository.UserKeyRepository) {
+	db, err := repository.Connect(cfg.Database)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	provider, err := utils.LoadKeyProvider(cfg.Encryption, keys)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return db, repository.NewUserKeyRepository(db, keys, provider)
+}
+
+// userCipher returns the cipher for a user's data, as the app uses it
+func userCipher(cfg *config.Config, keys *utils.DataKeys, userID uint) utils.FieldCipher {
+	db, userKeys := connect(cfg, keys)
+	defer db.Close()
+
+	cipher, err := userKeys.Cipher(userID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cipher
+}
+
+// rotationStep rotates one table, a batch at a time
+type rotationStep struct {
+	name  string
+	batch func(afterID uint, limit int) (repository.RotationBatch, error)
+}
+
+// rotate brings every encrypted table up to date with the current keys, batch
+// by batch, then rewraps the user keys with the key provider's current master
+// key. It prints its position after each batch so an interrupted run can be
+// resumed with -table and -after-id; restarting from scratch is also safe, just slower.
+func rotate(cfg *config.Config, keys *utils.DataKeys, startTable string, afterID uint, batchSize int) {
+	db, userKeys := connect(cfg, keys)
+	defer db.Close()
+
+	rotation := repository.NewKeyRotationRepository(db, userKeys)
+	fmt.Printf("Rotating to data key %q\n", keys.CurrentID())
+
+	var steps []rotationStep
+	for _, table := range repository.EncryptedTables {
+		steps = append(steps, rotationStep{name: table.Name, batch: func(afterID uint, limit int) (repository.RotationBatch, error) {
+			return rotation.RotateBatch(table, afterID, limit)
+		}})
+	}
+	steps = append(steps, rotationStep{name: "user_keys", batch: userKeys.RewrapBatch})
+
+	started := startTable == ""
+	for _, step := range steps {
+		if !started && step.name != startTable {
+			continue
+		}
+		started = true
+
+		lastID := afterID
+		rotated, skipped := 0, 0
+		for {
+			batch, err := step.batch(lastID, batchSize)
+			if err != nil {
+				log.Fatalf("%v\nResume with: -action=rotate -table=%s -after-id=%d", err, step.name, lastID)
+			}
+			rotated += batch.Rotated
+			skipped += batch.Skipped
+			lastID = batch.LastID
+
+			if batch.Scanned < batchSize {
+				break
+			}
+			fmt.Printf("%s: up to id %d, %d rotated\n", step.name, lastID, rotated)
+		}
+		fmt.Printf("%s: done, %d rotated, %d changed concurrently\n", step.name, rotated, skipped)
+
+		// -after-id only applies to the table being resumed
+		afterID = 0
+	}
+
+	if !started {
+		log.Fatalf("Unknown table %q", startTable)
+	}
+}
+
+// integrityReport is the JSON report written by verify
+type integrityReport struct {
+	StartedAt  time.Time                   `json:"startedAt"`
+	FinishedAt time.Time                   `json:"finishedAt"`
+	DataKeyID  string                      `json:"dataKeyId"`
+	Repair     bool                        `json:"repair"`
+	Tables     []tableIntegrity            `json:"tables"`
+	Issues     []repository.IntegrityIssue `json:"issues"`
+}
+
+type tableIntegrity struct {
+	Table    string `json:"table"`
+	Scanned  int    `json:"scanned"`
+	Issues   int    `json:"issues"`
+	Repaired int    `json:"repaired"`
+}
+
+// verify checks that every encrypted column decrypts and every blind index
+// matches its value, optionally repairing the blind indexes, and writes a JSON
+// report. Progress goes to stderr so the report can be piped. It exits with
+// status 2 if any issue is left unrepaired.
+func verify(cfg *config.Config, keys *utils.DataKeys, startTable string, afterID uint, batchSize int, repair bool, reportPath string) {
+	db, userKeys := connect(cfg, keys)
+	defer db.Close()
+
+	rotation := repository.NewKeyRotationRepository(db, userKeys)
+	report := integrityReport{
+		StartedAt: time.Now().UTC(),
+		DataKeyID: keys.CurrentID(),
+		Repair:    repair,
+		Issues:    []repository.IntegrityIssue{},
+	}
+
+	unrepaired := 0
+	started := startTable == ""
+	for _, table := range repository.EncryptedTables {
+		if !started && table.Name != startTable {
+			continue
+		}
+		started = true
+
+		summary := tableIntegrity{Table: table.Name}
+		lastID := afterID
+		for {
+			batch, err := rotation.VerifyBatch(table, lastID, batchSize, repair)
+			if err != nil {
+				log.Fatalf("%v\nResume with: -action=verify -table=%s -after-id=%d", err, table.Name, lastID)
+			}
+			summary.Scanned += batch.Scanned
+			for _, issue := range batch.Issues {
+				summary.Issues++
+				if issue.Repaired {
+					summary.Repaired++
+				} else {
+					unrepaired++
+				}
+			}
+			report.Issues = append(report.Issues, batch.Issues...)
+			lastID = batch.LastID
+
+			if batch.Scanned < batchSize {
+				break
+			}
+			fmt.Fprintf(os.Stderr, "%s: up to id %d, %d issues\n", table.Name, lastID, summary.Issues)
+		}
+		fmt.Fprintf(os.Stderr, "%s: done, %d scanned, %d issues, %d repaired\n", table.Name, summary.Scanned, summary.Issues, summary.Repaired)
+		report.Tables = append(report.Tables, summary)
+
+		// -after-id only applies to the table being resumed
+		afterID = 0
+	}
+
+	if !started {
+		log.Fatalf("Unknown table %q", startTable)
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	out := os.Stdout
+	if reportPath != "" {
+		var err error
+		if out, err = os.Create(reportPath); err != nil {
+			log.Fatal(err)
+		}
+		defer out.Close()
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+
+	if unrepaired > 0 {
+		os.Exit(2)
+	}
+}
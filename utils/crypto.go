@@ -10,15 +10,10 @@ import (
 	"encoding/hex"
 	"errors"
 	"io"
-	"os"
 )
 
-// GetEncryptionKey retrieves the encryption key from the environment
-func GetEncryptionKey() ([]byte, error) {
-	keyHex := os.Getenv("DATA_ENCRYPTION_KEY")
-	if keyHex == "" {
-		return nil, errors.New("DATA_ENCRYPTION_KEY environment variable is not set")
-	}
+// ParseEncryptionKey decodes the legacy DATA_ENCRYPTION_KEY
+func ParseEncryptionKey(keyHex string) ([]byte, error) {
 	key, err := hex.DecodeString(keyHex)
 	if err != nil {
 		return nil, errors.New("DATA_ENCRYPTION_KEY must be a valid hex string")
@@ -86,3 +81,19 @@ func Hash(input string, key []byte) string {
 	h.Write([]byte(input))
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// RandomToken returns a URL-safe random string carrying n bytes of entropy
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken computes the SHA-256 of a high-entropy secret such as a refresh token.
+// Unlike Hash it needs no key, as the input cannot be brute-forced.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
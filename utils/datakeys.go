@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"lunchorder/config"
+	"strings"
+)
+
+// LegacyDataKeyID is the key id given to DATA_ENCRYPTION_KEY. Ciphertexts written
+// before keys were versioned carry no prefix and are decrypted with this key.
+const LegacyDataKeyID = "v1"
+
+// Sub-keys are derived from each data key with HKDF so that encryption and
+// every blind index use unrelated keys
+const (
+	encryptionLabel = "lunchorder/encryption"
+	blindIndexLabel = "lunchorder/blind-index/"
+	derivedScheme   = "2"
+)
+
+var ErrUnknownDataKey = errors.New("unknown data encryption key")
+
+// DataKeys encrypts and blind-indexes personal data with the current key while
+// still reading values written with any older key, so keys can be rotated
+// without downtime. Ciphertexts are stored as "<kid>:2:<base64>".
+type DataKeys struct {
+	currentID string
+	keys      map[string][]byte
+	// ids lists the key ids with the current key first
+	ids []string
+	// legacyHashes makes lookups also try blind indexes computed with the key
+	// itself, for rows written before sub-keys were derived
+	legacyHashes bool
+}
+
+func NewDataKeys(currentID string, keys map[string][]byte) (*DataKeys, error) {
+	if _, ok := keys[currentID]; !ok {
+		return nil, fmt.Errorf("current data key %q is not configured", currentID)
+	}
+
+	dk := &DataKeys{currentID: currentID, keys: map[string][]byte{}, ids: []string{currentID}, legacyHashes: true}
+	for id, key := range keys {
+		if !validDataKeyID(id) {
+			return nil, fmt.Errorf("data key id %q may only contain letters, digits, '-' and '_'", id)
+		}
+		if id+":" == userKeyPrefix {
+			return nil, fmt.Errorf("data key id %q is reserved", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("data key %q must be 32 bytes (64 hex characters) for AES-256", id)
+		}
+		dk.keys[id] = key
+		if id != currentID {
+			dk.ids = append(dk.ids, id)
+		}
+	}
+	return dk, nil
+}
+
+// LoadDataKeys builds the data keys from the configuration.
+//
+// DATA_ENCRYPTION_KEYS holds comma-separated "kid:hex" entries and
+// DATA_ENCRYPTION_KEY_ID picks the key new values are written with, defaulting
+// to the first entry. The legacy DATA_ENCRYPTION_KEY is still accepted as key "v1".
+// DATA_ENCRYPTION_LEGACY_HASHES=false stops lookups from trying hashes computed
+// with the keys themselves.
+func LoadDataKeys(config config.EncryptionConfig) (*DataKeys, error) {
+	keys := map[string][]byte{}
+	var firstID string
+
+	for _, entry := range config.Keys {
+		id, keyHex, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, errors.New("DATA_ENCRYPTION_KEYS entry must look like kid:hex")
+		}
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("duplicate data key id %q", id)
+		}
+		key, err := hex.DecodeString(keyHex)
+		if err != nil {
+			return nil, fmt.Errorf("DATA_ENCRYPTION_KEYS %s must be a valid hex string", id)
+		}
+		keys[id] = key
+		if firstID == "" {
+			firstID = id
+		}
+	}
+
+	if config.LegacyKey != "" {
+		key, err := ParseEncryptionKey(config.LegacyKey)
+		if err != nil {
+			return nil, err
+		}
+		if existing, exists := keys[LegacyDataKeyID]; exists && !bytes.Equal(existing, key) {
+			return nil, fmt.Errorf("DATA_ENCRYPTION_KEY conflicts with DATA_ENCRYPTION_KEYS entry %q", LegacyDataKeyID)
+		}
+		keys[LegacyDataKeyID] = key
+		if firstID == "" {
+			firstID = LegacyDataKeyID
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("DATA_ENCRYPTION_KEYS or DATA_ENCRYPTION_KEY must be set")
+	}
+
+	currentID := config.KeyID
+	if currentID == "" {
+		currentID = firstID
+	}
+
+	dk, err := NewDataKeys(currentID, keys)
+	if err != nil {
+		return nil, err
+	}
+	dk.legacyHashes = config.LegacyHashes
+	return dk, nil
+}
+
+func validDataKeyID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// CurrentID returns the id of the key new values are written with
+func (k *DataKeys) CurrentID() string {
+	return k.currentID
+}
+
+// Encrypt encrypts plaintext with the encryption sub-key of the current key
+func (k *DataKeys) Encrypt(plaintext string) (string, error) {
+	ciphertext, err := Encrypt(plaintext, deriveKey(k.keys[k.currentID], encryptionLabel))
+	if err != nil {
+		return "", err
+	}
+	return k.currentID + ":" + derivedScheme + ":" + ciphertext, nil
+}
+
+// Decrypt decrypts a ciphertext with the key named by its prefix
+func (k *DataKeys) Decrypt(ciphertext string) (string, error) {
+	id, derived, body := parseCiphertext(ciphertext)
+	key, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownDataKey, id)
+	}
+	if derived {
+		key = deriveKey(key, encryptionLabel)
+	}
+	return Decrypt(body, key)
+}
+
+// Hash computes the blind index of input for the named index, e.g.
+// "users.email_hash", with the current key. Every index has its own sub-key,
+// so equal values in different columns do not have equal hashes.
+func (k *DataKeys) Hash(index string, input string) string {
+	return Hash(input, deriveKey(k.keys[k.currentID], blindIndexLabel+index))
+}
+
+// Hashes computes the blind index of input for the named index with every
+// known key, current first, so lookups also match rows that have not been
+// rotated yet. The legacy hashes are included until they are switched off.
+func (k *DataKeys) Hashes(index string, input string) []string {
+	var hashes []string
+	for _, id := range k.ids {
+		hashes = append(hashes, Hash(input, deriveKey(k.keys[id], blindIndexLabel+index)))
+	}
+	if k.legacyHashes {
+		hashes = append(hashes, k.LegacyHashes(input)...)
+	}
+	return hashes
+}
+
+// LegacyHashes computes the blind indexes of input with every known key
+// itself, the scheme used before sub-keys were derived. There is one set for
+// all indexes, as that scheme did not tell them apart.
+func (k *DataKeys) LegacyHashes(input string) []string {
+	var hashes []string
+	for _, id := range k.ids {
+		hashes = append(hashes, Hash(input, k.keys[id]))
+	}
+	return hashes
+}
+
+// IsCurrent reports whether a ciphertext was written with the current key and
+// scheme. Its row's blind indexes are then current too, as both are always
+// written together.
+func (k *DataKeys) IsCurrent(ciphertext string) bool {
+	id, derived, _ := parseCiphertext(ciphertext)
+	return id == k.currentID && derived
+}
+
+// parseCiphertext splits a stored ciphertext into its key id, whether it was
+// written with derived sub-keys, and the base64 body. The formats are
+// "<kid>:2:<body>" (derived sub-keys), "<kid>:<body>" (the key itself) and a
+// bare "<body>" (key v1). Base64 never contains ':', so they cannot be confused.
+func parseCiphertext(ciphertext string) (string, bool, string) {
+	id, rest, ok := strings.Cut(ciphertext, ":")
+	if !ok {
+		return LegacyDataKeyID, false, ciphertext
+	}
+	if scheme, body, ok := strings.Cut(rest, ":"); ok && scheme == derivedScheme {
+		return id, true, body
+	}
+	return id, false, rest
+}
+
+// deriveKey returns an independent 32-byte sub-key of master for one purpose
+func deriveKey(master []byte, label string) []byte {
+	key, err := hkdf.Key(sha256.New, master, nil, label, 32)
+	if err != nil {
+		// Only possible for lengths beyond what HKDF-SHA256 can produce
+		panic(err)
+	}
+	return key
+}
@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"lunchorder/config"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func testDataKeys(t *testing.T, currentID string) *DataKeys {
+	t.Helper()
+
+	keys, err := NewDataKeys(currentID, map[string][]byte{"v1": testKey(1), "v2": testKey(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestDataKeysRoundTripAcrossKeyIDs(t *testing.T) {
+	old := testDataKeys(t, "v1")
+	current := testDataKeys(t, "v2")
+
+	written, err := old.Encrypt("ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(written, "v1:2:") {
+		t.Fatalf("expected a v1 derived ciphertext, got %q", written)
+	}
+
+	tests := []struct {
+		name      string
+		keys      *DataKeys
+		isCurrent bool
+	}{
+		{name: "written with the current key", keys: old, isCurrent: true},
+		{name: "written with an older key", keys: current, isCurrent: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plaintext, err := test.keys.Decrypt(written)
+			if err != nil || plaintext != "ada@example.com" {
+				t.Errorf("got %q, %v", plaintext, err)
+			}
+			if test.keys.IsCurrent(written) != test.isCurrent {
+				t.Errorf("expected IsCurrent %v", test.isCurrent)
+			}
+		})
+	}
+}
+
+func TestDataKeysDecryptLegacyFormats(t *testing.T) {
+	keys := testDataKeys(t, "v2")
+
+	raw, err := Encrypt("ada@example.com", testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawCurrent, err := Encrypt("ada@example.com", testKey(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		ciphertext string
+	}{
+		{name: "bare body belongs to v1", ciphertext: raw},
+		{name: "kid without scheme uses the key itself", ciphertext: "v1:" + raw},
+		{name: "current kid without scheme", ciphertext: "v2:" + rawCurrent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plaintext, err := keys.Decrypt(test.ciphertext)
+			if err != nil || plaintext != "ada@example.com" {
+				t.Errorf("got %q, %v", plaintext, err)
+			}
+			if keys.IsCurrent(test.ciphertext) {
+				t.Errorf("legacy ciphertext %q reported as current", test.ciphertext)
+			}
+		})
+	}
+}
+
+func TestDataKeysDecryptErrors(t *testing.T) {
+	keys := testDataKeys(t, "v2")
+
+	other, err := Encrypt("ada@example.com", deriveKey(testKey(9), encryptionLabel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		ciphertext  string
+		unknownKeys bool
+	}{
+		{name: "unknown kid", ciphertext: "v9:2:" + other, unknownKeys: true},
+		{name: "unknown kid without scheme", ciphertext: "v9:" + other, unknownKeys: true},
+		{name: "wrong key", ciphertext: "v2:2:" + other},
+		{name: "derived body read as raw", ciphertext: "v2:" + other},
+		{name: "not base64", ciphertext: "v2:2:not base64!"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := keys.Decrypt(test.ciphertext)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if errors.Is(err, ErrUnknownDataKey) != test.unknownKeys {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestDataKeysHashes(t *testing.T) {
+	keys := testDataKeys(t, "v2")
+
+	email := keys.Hash("users.email_hash", "ada@example.com")
+	if email == keys.Hash("email_access_rules.email_hash", "ada@example.com") {
+		t.Error("different indexes must have different hashes")
+	}
+	if email == Hash("ada@example.com", testKey(2)) {
+		t.Error("the blind index must not be computed with the key itself")
+	}
+
+	hashes := keys.Hashes("users.email_hash", "ada@example.com")
+	if hashes[0] != email {
+		t.Errorf("expected the current hash first, got %v", hashes)
+	}
+	if !slices.Contains(hashes, testDataKeys(t, "v1").Hash("users.email_hash", "ada@example.com")) {
+		t.Error("expected the hash under the older key")
+	}
+
+	legacy := Hash("ada@example.com", testKey(1))
+	if !slices.Contains(hashes, legacy) {
+		t.Error("expected the legacy hash while legacy hashes are on")
+	}
+
+	keys.legacyHashes = false
+	if slices.Contains(keys.Hashes("users.email_hash", "ada@example.com"), legacy) {
+		t.Error("legacy hash still used after switching it off")
+	}
+	if !slices.Contains(keys.LegacyHashes("ada@example.com"), legacy) {
+		t.Error("LegacyHashes must still find legacy hashes for verify")
+	}
+}
+
+func TestNewDataKeysValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		currentID string
+		keys      map[string][]byte
+	}{
+		{name: "current key missing", currentID: "v3", keys: map[string][]byte{"v1": testKey(1)}},
+		{name: "invalid id", currentID: "v1", keys: map[string][]byte{"v1": testKey(1), "v:2": testKey(2)}},
+		{name: "reserved id", currentID: "v1", keys: map[string][]byte{"v1": testKey(1), "dek": testKey(2)}},
+		{name: "short key", currentID: "v1", keys: map[string][]byte{"v1": testKey(1)[:16]}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewDataKeys(test.currentID, test.keys); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadDataKeys(t *testing.T) {
+	hex1 := strings.Repeat("01", 32)
+	hex2 := strings.Repeat("02", 32)
+
+	tests := []struct {
+		name      string
+		config    config.EncryptionConfig
+		currentID string
+		wantErr   bool
+	}{
+		{name: "first entry is current", config: config.EncryptionConfig{Keys: []string{"v2:" + hex2, "v1:" + hex1}}, currentID: "v2"},
+		{name: "key id picks the current key", config: config.EncryptionConfig{Keys: []string{"v2:" + hex2, "v1:" + hex1}, KeyID: "v1"}, currentID: "v1"},
+		{name: "legacy key is v1", config: config.EncryptionConfig{LegacyKey: hex1}, currentID: "v1"},
+		{name: "legacy key matching its entry", config: config.EncryptionConfig{Keys: []string{"v2:" + hex2, "v1:" + hex1}, LegacyKey: hex1}, currentID: "v2"},
+		{name: "legacy key conflicting with its entry", config: config.EncryptionConfig{Keys: []string{"v1:" + hex2}, LegacyKey: hex1}, wantErr: true},
+		{name: "duplicate id", config: config.EncryptionConfig{Keys: []string{"v1:" + hex1, "v1:" + hex2}}, wantErr: true},
+		{name: "entry without id", config: config.EncryptionConfig{Keys: []string{hex1}}, wantErr: true},
+		{name: "no keys", config: config.EncryptionConfig{}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys, err := LoadDataKeys(test.config)
+			if test.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keys.CurrentID() != test.currentID {
+				t.Errorf("expected current key %q, got %q", test.currentID, keys.CurrentID())
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Models opt fields into encryption with struct tags on the plaintext field:
+//
+//	Email          *string `db:"-" encrypt:"email_encrypted" blindindex:"email_hash"`
+//	EmailEncrypted *string `db:"email_encrypted"`
+//	EmailHash      *string `db:"email_hash"`
+//
+// encrypt names the db column holding the ciphertext and the optional
+// blindindex the column holding its hash. Both must be fields of the same
+// struct. All three fields must be string or *string. If the plaintext field
+// is itself mapped to a column, that column is treated as legacy plaintext:
+// it is read when no ciphertext exists yet and cleared by the backfill.
+
+// EncryptedField describes one encrypted field of a model by its db columns.
+// Plaintext is empty unless a legacy plaintext column exists; Hash is empty
+// when the field has no blind index.
+type EncryptedField struct {
+	Plaintext string
+	Encrypted string
+	Hash      string
+}
+
+type taggedField struct {
+	EncryptedField
+	plaintext reflect.Value
+	encrypted reflect.Value
+	hash      reflect.Value
+}
+
+// EncryptedFields lists the encrypted fields of a model, e.g. User{}
+func EncryptedFields(model interface{}) []EncryptedField {
+	fields, err := taggedFields(reflect.New(reflect.TypeOf(model)).Elem())
+	if err != nil {
+		panic(err)
+	}
+	result := make([]EncryptedField, len(fields))
+	for i, field := range fields {
+		result[i] = field.EncryptedField
+	}
+	return result
+}
+
+// SealFields encrypts every tagged field of model, a pointer to a struct, and
+// computes its blind index, named "<table>.<hash column>". A nil plaintext
+// clears the ciphertext and hash.
+func SealFields(c FieldCipher, table string, model interface{}) error {
+	fields, err := taggedFields(reflect.ValueOf(model).Elem())
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		plaintext, ok := getString(field.plaintext)
+		if !ok {
+			setString(field.encrypted, "", false)
+			if field.Hash != "" {
+				setString(field.hash, "", false)
+			}
+			continue
+		}
+
+		encrypted, err := c.Encrypt(plaintext)
+		if err != nil {
+			return err
+		}
+		setString(field.encrypted, encrypted, true)
+		if field.Hash != "" {
+			setString(field.hash, c.Hash(table+"."+field.Hash, plaintext), true)
+		}
+	}
+	return nil
+}
+
+// OpenFields decrypts every tagged field of model, a pointer to a struct. A
+// field without ciphertext keeps its legacy plaintext value, if it has one,
+// and a field whose user key was deleted is left empty.
+func OpenFields(c FieldCipher, model interface{}) error {
+	fields, err := taggedFields(reflect.ValueOf(model).Elem())
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		encrypted, ok := getString(field.encrypted)
+		if !ok || encrypted == "" {
+			continue
+		}
+		plaintext, err := c.Decrypt(encrypted)
+		if errors.Is(err, ErrUserKeyShredded) {
+			setString(field.plaintext, "", false)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", field.Encrypted, err)
+		}
+		setString(field.plaintext, plaintext, true)
+	}
+	return nil
+}
+
+func taggedFields(v reflect.Value) ([]taggedField, error) {
+	t := v.Type()
+	columns := map[string]reflect.Value{}
+	for i := 0; i < t.NumField(); i++ {
+		if column := dbColumn(t.Field(i)); column != "" {
+			columns[column] = v.Field(i)
+		}
+	}
+
+	var fields []taggedField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		encryptedColumn := f.Tag.Get("encrypt")
+		if encryptedColumn == "" {
+			continue
+		}
+
+		field := taggedField{
+			EncryptedField: EncryptedField{
+				Plaintext: dbColumn(f),
+				Encrypted: encryptedColumn,
+				Hash:      f.Tag.Get("blindindex"),
+			},
+			plaintext: v.Field(i),
+		}
+
+		var ok bool
+		if field.encrypted, ok = columns[field.Encrypted]; !ok {
+			return nil, fmt.Errorf("%s.%s: no field for column %q", t.Name(), f.Name, field.Encrypted)
+		}
+		if field.Hash != "" {
+			if field.hash, ok = columns[field.Hash]; !ok {
+				return nil, fmt.Errorf("%s.%s: no field for column %q", t.Name(), f.Name, field.Hash)
+			}
+		}
+		for _, value := range []reflect.Value{field.plaintext, field.encrypted, field.hash} {
+			if value.IsValid() && !isStringField(value.Type()) {
+				return nil, fmt.Errorf("%s.%s: encrypted fields must be string or *string", t.Name(), f.Name)
+			}
+		}
+
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func dbColumn(f reflect.StructField) string {
+	column, _, _ := strings.Cut(f.Tag.Get("db"), ",")
+	if column == "-" {
+		return ""
+	}
+	return column
+}
+
+func isStringField(t reflect.Type) bool {
+	return t.Kind() == reflect.String || t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.String
+}
+
+func getString(v reflect.Value) (string, bool) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		return v.Elem().String(), true
+	}
+	return v.String(), true
+}
+
+// setString sets v to s, or to nil (or "" for a plain string) when ok is false
+func setString(v reflect.Value, s string, ok bool) {
+	if v.Kind() != reflect.Ptr {
+		v.SetString(s)
+		return
+	}
+	if !ok {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	p := reflect.New(v.Type().Elem())
+	p.Elem().SetString(s)
+	v.Set(p)
+}
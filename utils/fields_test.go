@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type sealedModel struct {
+	Email          *string `db:"-" encrypt:"email_encrypted" blindindex:"email_hash"`
+	EmailEncrypted *string `db:"email_encrypted"`
+	EmailHash      *string `db:"email_hash"`
+	// Name has a legacy plaintext column and no blind index
+	Name          string  `db:"name" encrypt:"name_encrypted"`
+	NameEncrypted *string `db:"name_encrypted"`
+}
+
+func stringPointer(s string) *string {
+	return &s
+}
+
+func TestSealAndOpenFieldsRoundTrip(t *testing.T) {
+	old := testDataKeys(t, "v1")
+	current := testDataKeys(t, "v2")
+	dek, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		seal   FieldCipher
+		open   FieldCipher
+		prefix string
+	}{
+		{name: "same key", seal: current, open: current, prefix: "v2:2:"},
+		{name: "older key", seal: old, open: current, prefix: "v1:2:"},
+		{name: "user key", seal: NewUserCipher(dek, current), open: NewUserCipher(dek, old), prefix: userKeyPrefix},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			model := sealedModel{Email: stringPointer("ada@example.com"), Name: "Ada"}
+			if err := SealFields(test.seal, "users", &model); err != nil {
+				t.Fatal(err)
+			}
+
+			if model.EmailEncrypted == nil || !strings.HasPrefix(*model.EmailEncrypted, test.prefix) {
+				t.Errorf("expected a ciphertext starting with %q, got %v", test.prefix, model.EmailEncrypted)
+			}
+			if model.EmailHash == nil || *model.EmailHash != test.seal.Hash("users.email_hash", "ada@example.com") {
+				t.Errorf("unexpected blind index %v", model.EmailHash)
+			}
+
+			opened := sealedModel{EmailEncrypted: model.EmailEncrypted, NameEncrypted: model.NameEncrypted}
+			if err := OpenFields(test.open, &opened); err != nil {
+				t.Fatal(err)
+			}
+			if opened.Email == nil || *opened.Email != "ada@example.com" || opened.Name != "Ada" {
+				t.Errorf("unexpected fields after opening: %+v", opened)
+			}
+		})
+	}
+}
+
+func TestSealFieldsClearsNil(t *testing.T) {
+	keys := testDataKeys(t, "v2")
+	model := sealedModel{EmailEncrypted: stringPointer("stale"), EmailHash: stringPointer("stale")}
+
+	if err := SealFields(keys, "users", &model); err != nil {
+		t.Fatal(err)
+	}
+	if model.EmailEncrypted != nil || model.EmailHash != nil {
+		t.Errorf("expected the ciphertext and hash to be cleared, got %+v", model)
+	}
+}
+
+func TestOpenFieldsLegacyAndErrors(t *testing.T) {
+	keys := testDataKeys(t, "v2")
+	other, err := NewDataKeys("v3", map[string][]byte{"v3": testKey(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := other.Encrypt("Ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := Encrypt("ada@example.com", testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cipher  FieldCipher
+		model   sealedModel
+		want    sealedModel
+		wantErr error
+	}{
+		{
+			name:   "no ciphertext keeps the legacy plaintext",
+			cipher: keys,
+			model:  sealedModel{Name: "Ada"},
+			want:   sealedModel{Name: "Ada"},
+		},
+		{
+			name:   "unprefixed ciphertext is read with v1",
+			cipher: keys,
+			model:  sealedModel{EmailEncrypted: &raw},
+			want:   sealedModel{Email: stringPointer("ada@example.com"), EmailEncrypted: &raw},
+		},
+		{
+			name:    "unknown key id",
+			cipher:  keys,
+			model:   sealedModel{NameEncrypted: &foreign},
+			wantErr: ErrUnknownDataKey,
+		},
+		{
+			name:   "shredded user key leaves the field empty",
+			cipher: NewUserCipher(nil, keys),
+			model:  sealedModel{Email: stringPointer("old"), EmailEncrypted: stringPointer(userKeyPrefix + raw)},
+			want:   sealedModel{EmailEncrypted: stringPointer(userKeyPrefix + raw)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := OpenFields(test.cipher, &test.model)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) || !strings.Contains(err.Error(), "name_encrypted") {
+					t.Errorf("expected %v naming the column, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(test.model, test.want) {
+				t.Errorf("got %+v, want %+v", test.model, test.want)
+			}
+		})
+	}
+}
+
+func TestEncryptedFieldsValidation(t *testing.T) {
+	type missingColumn struct {
+		Email *string `db:"-" encrypt:"email_encrypted"`
+	}
+	type notString struct {
+		Count          int     `db:"-" encrypt:"count_encrypted"`
+		CountEncrypted *string `db:"count_encrypted"`
+	}
+
+	if fields := EncryptedFields(sealedModel{}); !reflect.DeepEqual(fields, []EncryptedField{
+		{Encrypted: "email_encrypted", Hash: "email_hash"},
+		{Plaintext: "name", Encrypted: "name_encrypted"},
+	}) {
+		t.Errorf("unexpected fields %+v", fields)
+	}
+
+	for _, model := range []interface{}{&missingColumn{}, &notString{}} {
+		if err := SealFields(testDataKeys(t, "v2"), "users", model); err == nil {
+			t.Errorf("expected an error for %T", model)
+		}
+	}
+}
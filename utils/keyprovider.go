@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"lunchorder/config"
+	"net/http"
+	"os"
+	"time"
+)
+
+// KeyProvider wraps data-encryption keys (DEKs) with a master key it keeps to
+// itself. Only wrapped DEKs are stored; deleting one makes everything it
+// encrypted unreadable.
+type KeyProvider interface {
+	WrapKey(dek []byte) (string, error)
+	UnwrapKey(wrapped string) ([]byte, error)
+}
+
+// keyWrappingLabel derives the sub-key DataKeys wraps DEKs with
+const keyWrappingLabel = "lunchorder/key-wrapping"
+
+// WrapKey makes DataKeys a KeyProvider. DEKs are wrapped with a sub-key of the
+// current data key, so rotating the data keys rotates the master key too.
+func (k *DataKeys) WrapKey(dek []byte) (string, error) {
+	wrapped, err := Encrypt(base64.StdEncoding.EncodeToString(dek), deriveKey(k.keys[k.currentID], keyWrappingLabel))
+	if err != nil {
+		return "", err
+	}
+	return k.currentID + ":" + derivedScheme + ":" + wrapped, nil
+}
+
+func (k *DataKeys) UnwrapKey(wrapped string) ([]byte, error) {
+	id, _, body := parseCiphertext(wrapped)
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownDataKey, id)
+	}
+	dek, err := Decrypt(body, deriveKey(key, keyWrappingLabel))
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(dek)
+}
+
+// LoadKeyProvider builds the key provider chosen by KEY_PROVIDER:
+//
+//   - env (default): wraps with the data keys themselves
+//   - file: a JSON keyring at KEY_PROVIDER_FILE, see LoadFileKeyProvider
+//   - http: a KMS-style service at KEY_PROVIDER_URL, see HTTPKeyProvider
+func LoadKeyProvider(config config.EncryptionConfig, keys *DataKeys) (KeyProvider, error) {
+	switch config.Provider {
+	case "", "env":
+		return keys, nil
+	case "file":
+		fileKeys, err := LoadFileKeyProvider(config.ProviderFile)
+		if err != nil {
+			return nil, err
+		}
+		return fileKeys, nil
+	case "http":
+		return NewHTTPKeyProvider(config.ProviderURL, config.ProviderKeyID, config.ProviderToken), nil
+	default:
+		return nil, fmt.Errorf("unknown KEY_PROVIDER %q, use env, file or http", config.Provider)
+	}
+}
+
+// fileKeyring is the format of the KEY_PROVIDER_FILE keyring
+type fileKeyring struct {
+	CurrentKeyID string            `json:"currentKeyId"`
+	Keys         map[string]string `json:"keys"`
+}
+
+// LoadFileKeyProvider reads a local keyring file such as
+//
+//	{"currentKeyId": "k2", "keys": {"k1": "<64 hex chars>", "k2": "<64 hex chars>"}}
+//
+// which keeps the master keys out of the environment. currentKeyId defaults
+// to the only key when there is just one.
+func LoadFileKeyProvider(path string) (*DataKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyring fileKeyring
+	if err := json.Unmarshal(data, &keyring); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	keys := map[string][]byte{}
+	for id, keyHex := range keyring.Keys {
+		key, err := hex.DecodeString(keyHex)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %s must be a valid hex string", path, id)
+		}
+		keys[id] = key
+		if keyring.CurrentKeyID == "" && len(keyring.Keys) == 1 {
+			keyring.CurrentKeyID = id
+		}
+	}
+
+	return NewDataKeys(keyring.CurrentKeyID, keys)
+}
+
+// HTTPKeyProvider wraps keys with a remote key management service, so the
+// master key never leaves it. It speaks a minimal KMS-style JSON API:
+//
+//	POST <url>/wrap   {"keyId": "...", "plaintext": "<base64>"} -> {"ciphertext": "..."}
+//	POST <url>/unwrap {"ciphertext": "..."}                     -> {"plaintext": "<base64>"}
+//
+// The ciphertext is opaque and must identify its master key to the service.
+type HTTPKeyProvider struct {
+	url    string
+	keyID  string
+	token  string
+	client *http.Client
+}
+
+func NewHTTPKeyProvider(url string, keyID string, token string) *HTTPKeyProvider {
+	return &HTTPKeyProvider{
+		url:    url,
+		keyID:  keyID,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type httpKeyRequest struct {
+	KeyID      string `json:"keyId,omitempty"`
+	Plaintext  string `json:"plaintext,omitempty"`
+	Ciphertext string `json:"ciphertext,omitempty"`
+}
+
+type httpKeyResponse struct {
+	Plaintext  string `json:"plaintext"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+func (p *HTTPKeyProvider) WrapKey(dek []byte) (string, error) {
+	response, err := p.call("/wrap", httpKeyRequest{
+		KeyID:     p.keyID,
+		Plaintext: base64.StdEncoding.EncodeToString(dek),
+	})
+	if err != nil {
+		return "", err
+	}
+	if response.Ciphertext == "" {
+		return "", errors.New("key provider returned no ciphertext")
+	}
+	return response.Ciphertext, nil
+}
+
+func (p *HTTPKeyProvider) UnwrapKey(wrapped string) ([]byte, error) {
+	response, err := p.call("/unwrap", httpKeyRequest{Ciphertext: wrapped})
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(response.Plaintext)
+}
+
+func (p *HTTPKeyProvider) call(path string, body httpKeyRequest) (*httpKeyResponse, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.url+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("key provider %s returned %s", path, res.Status)
+	}
+
+	var response httpKeyResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+)
+
+// userKeyPrefix marks values encrypted with a user's own DEK. It is reserved
+// and cannot be used as a data key id.
+const userKeyPrefix = "dek:"
+
+// ErrUserKeyShredded is returned for values whose user's DEK has been deleted
+var ErrUserKeyShredded = errors.New("user data key has been deleted")
+
+// FieldCipher encrypts and blind-indexes the tagged fields of a model
+type FieldCipher interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, error)
+	Hash(index string, input string) string
+	// IsCurrent reports whether a ciphertext needs no re-encryption
+	IsCurrent(ciphertext string) bool
+}
+
+// UserCipher encrypts one user's fields with their own data-encryption key.
+// Blind indexes cannot be per user, as they are looked up before the user is
+// known, so they and values written before per-user keys use the data keys.
+type UserCipher struct {
+	dek  []byte
+	keys *DataKeys
+}
+
+// NewUserCipher returns a cipher for a user's DEK. A nil dek means the user
+// has no key (yet, or any more): values are written with the data keys and
+// values written with a deleted DEK read as ErrUserKeyShredded.
+func NewUserCipher(dek []byte, keys *DataKeys) *UserCipher {
+	return &UserCipher{dek: dek, keys: keys}
+}
+
+// NewDataKey generates a random 256-bit DEK
+func NewDataKey() ([]byte, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+	return dek, nil
+}
+
+func (c *UserCipher) Encrypt(plaintext string) (string, error) {
+	if c.dek == nil {
+		return c.keys.Encrypt(plaintext)
+	}
+	ciphertext, err := Encrypt(plaintext, c.dek)
+	if err != nil {
+		return "", err
+	}
+	return userKeyPrefix + ciphertext, nil
+}
+
+func (c *UserCipher) Decrypt(ciphertext string) (string, error) {
+	body, ok := strings.CutPrefix(ciphertext, userKeyPrefix)
+	if !ok {
+		return c.keys.Decrypt(ciphertext)
+	}
+	if c.dek == nil {
+		return "", ErrUserKeyShredded
+	}
+	return Decrypt(body, c.dek)
+}
+
+func (c *UserCipher) Hash(index string, input string) string {
+	return c.keys.Hash(index, input)
+}
+
+// HasKey reports whether the user has a DEK of their own
+func (c *UserCipher) HasKey() bool {
+	return c.dek != nil
+}
+
+// IsCurrent reports whether a value is encrypted with the user's DEK. The DEK
+// itself is never rotated; rotating the master key only rewraps it.
+func (c *UserCipher) IsCurrent(ciphertext string) bool {
+	if c.dek == nil {
+		return c.keys.IsCurrent(ciphertext)
+	}
+	return strings.HasPrefix(ciphertext, userKeyPrefix)
+}